@@ -20,13 +20,21 @@ package pmm
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 var (
@@ -35,17 +43,99 @@ var (
 	PROM_API_PORT  string = "9003"
 )
 
+// DefaultAPITimeout is used when APIOptions.Timeout is zero.
+const DefaultAPITimeout = 5 * time.Second
+
+// Defaults applied to a zero-value RetryPolicy (MaxAttempts == 0), i.e.
+// when the caller didn't opt into a specific retry policy.
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryBaseDelay   = 200 * time.Millisecond
+	DefaultRetryMaxDelay    = 5 * time.Second
+)
+
+// RetryPolicy controls how API retries a request that fails with a
+// connection error or one of RetriableStatusCodes. Delay doubles after
+// each attempt (capped at MaxDelay), with optional jitter.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      bool
+
+	// RetriableStatusCodes defaults to {502, 503, 504} when nil.
+	RetriableStatusCodes map[int]bool
+}
+
+func (p RetryPolicy) resolved() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = DefaultRetryBaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultRetryMaxDelay
+	}
+	return p
+}
+
+func (p RetryPolicy) isRetriableStatus(code int) bool {
+	if p.RetriableStatusCodes == nil {
+		return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+	}
+	return p.RetriableStatusCodes[code]
+}
+
+// APIOptions configures authentication, transport security, and retry
+// behavior for API. The zero value is a plain, unauthenticated HTTP client
+// with the default retry policy, same as before.
+type APIOptions struct {
+	// APIKey/Token authenticate against a PMM server that requires it.
+	// Token, if set, is sent as "Authorization: Bearer <Token>"; APIKey,
+	// if set, is sent as "X-API-Key: <APIKey>". Both can be set at once.
+	APIKey string
+	Token  string
+
+	// TLS, for PMM servers fronted by HTTPS.
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+
+	// Timeout is the per-attempt request timeout. Defaults to DefaultAPITimeout.
+	Timeout time.Duration
+
+	// Retry controls retries on connection errors and 5xx responses.
+	Retry RetryPolicy
+
+	// Backend labels every span and metric this client records (e.g.
+	// "consul", "qan", "agent"), so requests to different backends show
+	// up as distinct series/traces instead of one undifferentiated
+	// blob. Defaults to "api" if empty.
+	Backend string
+}
+
+// useTLS reports whether these options require an HTTPS transport.
+func (o APIOptions) useTLS() bool {
+	return o.CAFile != "" || o.CertFile != "" || o.InsecureSkipVerify
+}
+
 type API struct {
 	headers  map[string]string
 	hostname string
+	opts     APIOptions
+	client   *http.Client
 }
 
-func NewAPI(headers map[string]string) *API {
+func NewAPI(headers map[string]string, opts APIOptions) *API {
 	hostname, _ := os.Hostname()
 	a := &API{
 		headers:  headers,
 		hostname: hostname,
+		opts:     opts,
 	}
+	a.client = a.newClient()
 	return a
 }
 
@@ -58,14 +148,9 @@ func (a *API) Ping(url string) error {
 	if err != nil {
 		return err
 	}
-	if a.headers != nil {
-		for k, v := range a.headers {
-			req.Header.Add(k, v)
-		}
-	}
+	a.setHeaders(req)
 
-	client := newClient()
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 	if err != nil {
 		return err
 	}
@@ -83,12 +168,15 @@ func (a *API) Ping(url string) error {
 func (a *API) URL(addr string, paths ...string) string {
 	schema := "http://"
 	httpPrefix := "http://"
-	if strings.HasPrefix(addr, httpPrefix) {
+	httpsPrefix := "https://"
+	if strings.HasPrefix(addr, httpsPrefix) {
+		addr = strings.TrimPrefix(addr, httpsPrefix)
+		schema = httpsPrefix
+	} else if strings.HasPrefix(addr, httpPrefix) {
 		addr = strings.TrimPrefix(addr, httpPrefix)
+	} else if a.opts.useTLS() {
+		schema = httpsPrefix
 	}
-	//if strings.HasPrefix(addr, "localhost") || strings.HasPrefix(addr, "127.0.0.1") {
-	//	schema = httpPrefix
-	//}
 	slash := "/"
 	if len(paths) > 0 && paths[0][0] == 0x2F {
 		slash = ""
@@ -97,18 +185,25 @@ func (a *API) URL(addr string, paths ...string) string {
 }
 
 func (a *API) Get(url string) (*http.Response, []byte, error) {
+	return a.get(context.Background(), url)
+}
+
+// GetCtx is Get, but spans the request under ctx instead of a fresh
+// root span. Combine with WithRequestAttrs to record pmm.node/pmm.job
+// on the span, the way serviceExists does.
+func (a *API) GetCtx(ctx context.Context, url string) (*http.Response, []byte, error) {
+	return a.get(ctx, url)
+}
+
+func (a *API) get(ctx context.Context, url string) (*http.Response, []byte, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, nil, err
 	}
-	if a.headers != nil {
-		for k, v := range a.headers {
-			req.Header.Add(k, v)
-		}
-	}
+	req = req.WithContext(ctx)
+	a.setHeaders(req)
 
-	client := newClient()
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -136,24 +231,170 @@ func (a *API) Get(url string) (*http.Response, []byte, error) {
 }
 
 func (a *API) Post(url string, data []byte) (*http.Response, []byte, error) {
-	return a.send("POST", url, data)
+	return a.send(context.Background(), "POST", url, data)
 }
 
 func (a *API) Put(url string, data []byte) (*http.Response, []byte, error) {
-	return a.send("PUT", url, data)
+	return a.send(context.Background(), "PUT", url, data)
+}
+
+// PutCtx is Put, but spans the request under ctx instead of a fresh
+// root span. Combine with WithRequestAttrs to record pmm.node/pmm.job
+// on the span, the way RegisterService does.
+func (a *API) PutCtx(ctx context.Context, url string, data []byte) (*http.Response, []byte, error) {
+	return a.send(ctx, "PUT", url, data)
 }
 
 func (a *API) Delete(url string) (*http.Response, []byte, error) {
-	return a.send("DELETE", url, nil)
+	return a.send(context.Background(), "DELETE", url, nil)
 }
 
 // --------------------------------------------------------------------------
 
-func newClient() *http.Client {
-	return &http.Client{Timeout: time.Duration(5 * time.Second)}
+// newClient builds the *http.Client used for every request, configuring
+// TLS (CA bundle, client cert/key, InsecureSkipVerify) and the timeout
+// from a.opts.
+func (a *API) newClient() *http.Client {
+	timeout := a.opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultAPITimeout
+	}
+
+	if !a.opts.useTLS() && a.opts.CertFile == "" {
+		return &http.Client{Timeout: timeout}
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: a.opts.InsecureSkipVerify}
+
+	if a.opts.CAFile != "" {
+		pem, err := ioutil.ReadFile(a.opts.CAFile)
+		if err == nil {
+			pool := x509.NewCertPool()
+			if pool.AppendCertsFromPEM(pem) {
+				tlsConfig.RootCAs = pool
+			}
+		}
+	}
+
+	if a.opts.CertFile != "" && a.opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(a.opts.CertFile, a.opts.KeyFile)
+		if err == nil {
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
 }
 
-func (a *API) send(method, url string, data []byte) (*http.Response, []byte, error) {
+// do executes req, retrying on connection errors and retriable status
+// codes per a.opts.Retry. req must have been built by http.NewRequest
+// with a nil body or a body type (e.g. *bytes.Reader) that populates
+// req.GetBody, so the body can be replayed on each attempt.
+//
+// Every call is traced (http.method/http.url/http.status_code, plus
+// pmm.node/pmm.job when the request's context carries them - see
+// WithRequestAttrs) and counted against the pmm_admin_api_* metrics,
+// regardless of backend: this is the single chokepoint every Get/Put/
+// Post/Delete call funnels through.
+func (a *API) do(req *http.Request) (*http.Response, error) {
+	backend := a.opts.Backend
+	if backend == "" {
+		backend = "api"
+	}
+
+	ctx, span := tracer.Start(req.Context(), "pmm.api."+req.Method)
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("http.method", req.Method),
+		attribute.String("http.url", req.URL.String()),
+	)
+	if attrs, ok := requestAttrsFrom(ctx); ok {
+		if attrs.node != "" {
+			span.SetAttributes(attribute.String("pmm.node", attrs.node))
+		}
+		if attrs.job != "" {
+			span.SetAttributes(attribute.String("pmm.job", attrs.job))
+		}
+	}
+	req = req.WithContext(ctx)
+
+	start := time.Now()
+	policy := a.opts.Retry.resolved()
+	delay := policy.BaseDelay
+
+	var resp *http.Response
+	var err error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			retriesTotal.WithLabelValues(backend, req.Method).Inc()
+			if req.GetBody != nil {
+				body, gbErr := req.GetBody()
+				if gbErr != nil {
+					span.RecordError(gbErr)
+					return nil, gbErr
+				}
+				req.Body = body
+			}
+		}
+
+		resp, err = a.client.Do(req)
+		if err == nil && !policy.isRetriableStatus(resp.StatusCode) {
+			break
+		}
+		if attempt == policy.MaxAttempts {
+			break
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		sleep := delay
+		if policy.Jitter {
+			sleep = time.Duration(float64(sleep) * (0.5 + rand.Float64()))
+		}
+		time.Sleep(sleep)
+
+		delay *= 2
+		if delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+	}
+
+	requestDuration.WithLabelValues(backend, req.Method).Observe(time.Since(start).Seconds())
+	status := "error"
+	if resp != nil {
+		status = strconv.Itoa(resp.StatusCode)
+		span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	}
+	requestsTotal.WithLabelValues(backend, req.Method, status).Inc()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return resp, err
+}
+
+// setHeaders applies the caller-supplied headers plus any configured
+// API key/token authentication to req.
+func (a *API) setHeaders(req *http.Request) {
+	if a.headers != nil {
+		for k, v := range a.headers {
+			req.Header.Add(k, v)
+		}
+	}
+	if a.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.opts.Token)
+	}
+	if a.opts.APIKey != "" {
+		req.Header.Set("X-API-Key", a.opts.APIKey)
+	}
+}
+
+func (a *API) send(ctx context.Context, method, url string, data []byte) (*http.Response, []byte, error) {
 	var req *http.Request
 	var err error
 	if data != nil {
@@ -164,14 +405,10 @@ func (a *API) send(method, url string, data []byte) (*http.Response, []byte, err
 	if err != nil {
 		return nil, nil, err
 	}
-	if a.headers != nil {
-		for k, v := range a.headers {
-			req.Header.Add(k, v)
-		}
-	}
+	req = req.WithContext(ctx)
+	a.setHeaders(req)
 
-	client := newClient()
-	resp, err := client.Do(req)
+	resp, err := a.do(req)
 	if err != nil {
 		return resp, nil, err
 	}
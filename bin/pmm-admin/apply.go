@@ -0,0 +1,403 @@
+/*
+	Copyright (c) 2016, Percona LLC and/or its affiliates. All rights reserved.
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/percona/go-mysql/dsn"
+	pmm "github.com/percona/pmm-admin"
+	"github.com/percona/pmm-admin/output"
+	"gopkg.in/yaml.v2"
+)
+
+// Manifest is the input to "pmm-admin apply -f <file>": the server to
+// report to, this node's OS entry, and any number of database instances,
+// all in one file instead of one "pmm-admin add" per instance.
+type Manifest struct {
+	Server string      `yaml:"server"`
+	OS     *ManifestOS `yaml:"os"`
+
+	MySQL      []ManifestMySQL      `yaml:"mysql"`
+	MongoDB    []ManifestMongoDB    `yaml:"mongodb"`
+	PostgreSQL []ManifestPostgreSQL `yaml:"postgresql"`
+	ProxySQL   []ManifestProxySQL   `yaml:"proxysql"`
+}
+
+type ManifestOS struct {
+	Address string `yaml:"address"`
+}
+
+type ManifestMySQL struct {
+	Name          string `yaml:"name"`
+	DefaultsFile  string `yaml:"defaults_file"`
+	User          string `yaml:"user"`
+	Password      string `yaml:"password"`
+	Host          string `yaml:"host"`
+	Port          string `yaml:"port"`
+	Socket        string `yaml:"socket"`
+	AgentUser     string `yaml:"agent_user"`
+	AgentPassword string `yaml:"agent_password"`
+	QuerySource   string `yaml:"query_source"`
+	OldPasswords  bool   `yaml:"old_passwords"`
+	MaxUserConn   int64  `yaml:"max_user_connections"`
+	Start         *bool  `yaml:"start"`
+}
+
+type ManifestMongoDB struct {
+	Name    string `yaml:"name"`
+	URI     string `yaml:"uri"`
+	ReplSet string `yaml:"replset"`
+	Cluster string `yaml:"cluster"`
+	Start   *bool  `yaml:"start"`
+}
+
+type ManifestPostgreSQL struct {
+	Name     string `yaml:"name"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	SSLMode  string `yaml:"sslmode"`
+	Start    *bool  `yaml:"start"`
+}
+
+type ManifestProxySQL struct {
+	Name     string `yaml:"name"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Start    *bool  `yaml:"start"`
+}
+
+func loadManifest(file string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := yaml.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("cannot parse manifest %s: %s", file, err)
+	}
+	return m, nil
+}
+
+// applyAction is one planned change: an instance to add because it's in
+// the manifest but not yet in the inventory, to update because it's in
+// both but drifted, or, with -prune, to remove because it's no longer in
+// the manifest.
+type applyAction struct {
+	Action string `json:"action" yaml:"action"` // "add", "update", or "remove"
+	Type   string `json:"type" yaml:"type"`
+	Name   string `json:"name" yaml:"name"`
+}
+
+// planApply diffs manifest against the current inventory (admin.List()).
+// A manifest entry not already in current is planned as an "add". One
+// already present is planned as an "update" if it's drifted from the
+// manifest, detected by comparing the replset/cluster tags mongodb
+// registers in Consul (the only per-instance config this tree can read
+// back unambiguously - see pmm.InstanceStatus.DSNMasked's doc comment).
+// mysql/postgresql/proxysql entries are left alone if already present:
+// their recorded DSN either reflects agent-specific credentials
+// (mysql, via the QAN API) or isn't persisted at all (postgresql,
+// proxysql), so there's nothing to diff against the manifest's raw
+// connection params without false positives. A changed entry of those
+// types still requires removing it (by hand, or via -prune) and
+// re-applying.
+func planApply(m *Manifest, current map[string][]pmm.InstanceStatus, prune bool) []applyAction {
+	var actions []applyAction
+
+	existing := map[string]map[string]pmm.InstanceStatus{
+		"mysql":      {},
+		"mongodb":    {},
+		"postgresql": {},
+		"proxysql":   {},
+	}
+	for instanceType, instances := range current {
+		for _, in := range instances {
+			if existing[instanceType] == nil {
+				continue
+			}
+			existing[instanceType][in.Name] = in
+		}
+	}
+
+	wanted := map[string]map[string]bool{
+		"mysql":      {},
+		"mongodb":    {},
+		"postgresql": {},
+		"proxysql":   {},
+	}
+	for _, e := range m.MySQL {
+		wanted["mysql"][e.Name] = true
+		if _, ok := existing["mysql"][e.Name]; !ok {
+			actions = append(actions, applyAction{"add", "mysql", e.Name})
+		}
+	}
+	for _, e := range m.MongoDB {
+		wanted["mongodb"][e.Name] = true
+		in, ok := existing["mongodb"][e.Name]
+		if !ok {
+			actions = append(actions, applyAction{"add", "mongodb", e.Name})
+		} else if mongoTagsDrifted(e, in) {
+			actions = append(actions, applyAction{"update", "mongodb", e.Name})
+		}
+	}
+	for _, e := range m.PostgreSQL {
+		wanted["postgresql"][e.Name] = true
+		if _, ok := existing["postgresql"][e.Name]; !ok {
+			actions = append(actions, applyAction{"add", "postgresql", e.Name})
+		}
+	}
+	for _, e := range m.ProxySQL {
+		wanted["proxysql"][e.Name] = true
+		if _, ok := existing["proxysql"][e.Name]; !ok {
+			actions = append(actions, applyAction{"add", "proxysql", e.Name})
+		}
+	}
+
+	if prune {
+		for instanceType, names := range wanted {
+			for _, in := range current[instanceType] {
+				if !names[in.Name] {
+					actions = append(actions, applyAction{"remove", instanceType, in.Name})
+				}
+			}
+		}
+	}
+
+	return actions
+}
+
+// mongoTagsDrifted reports whether e's replset/cluster no longer match
+// what's registered in Consul for the current instance in.
+func mongoTagsDrifted(e ManifestMongoDB, in pmm.InstanceStatus) bool {
+	var wantTags []string
+	if e.ReplSet != "" {
+		wantTags = append(wantTags, "replset_"+e.ReplSet)
+	}
+	if e.Cluster != "" {
+		wantTags = append(wantTags, "cluster_"+e.Cluster)
+	}
+
+	haveTags := map[string]bool{}
+	if tags, ok := in.Tags.([]interface{}); ok {
+		for _, t := range tags {
+			if s, ok := t.(string); ok {
+				haveTags[s] = true
+			}
+		}
+	}
+
+	if len(wantTags) != len(haveTags) {
+		return true
+	}
+	for _, t := range wantTags {
+		if !haveTags[t] {
+			return true
+		}
+	}
+	return false
+}
+
+// runApply executes actions against the manifest, continuing past
+// individual failures so one bad entry doesn't abort the whole batch,
+// and returns every error encountered.
+func runApply(m *Manifest, actions []applyAction) []error {
+	var errs []error
+	for _, a := range actions {
+		var err error
+		switch a.Action {
+		case "add":
+			err = applyAdd(m, a.Type, a.Name)
+		case "update":
+			// No in-place update path for a drifted instance (see
+			// planApply): remove and re-add it to converge.
+			if err = applyRemove(a.Type, a.Name); err == nil {
+				err = applyAdd(m, a.Type, a.Name)
+			}
+		case "remove":
+			err = applyRemove(a.Type, a.Name)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %s %s: %s", a.Action, a.Type, a.Name, err))
+		}
+	}
+	return errs
+}
+
+func applyAdd(m *Manifest, instanceType, name string) error {
+	switch instanceType {
+	case "mysql":
+		for _, e := range m.MySQL {
+			if e.Name == name {
+				return applyMySQL(e)
+			}
+		}
+	case "mongodb":
+		for _, e := range m.MongoDB {
+			if e.Name == name {
+				return admin.AddMongoDB(e.Name, manifestStart(e.Start), e.URI, e.ReplSet, e.Cluster)
+			}
+		}
+	case "postgresql":
+		for _, e := range m.PostgreSQL {
+			if e.Name == name {
+				return applyPostgreSQL(e)
+			}
+		}
+	case "proxysql":
+		for _, e := range m.ProxySQL {
+			if e.Name == name {
+				return applyProxySQL(e)
+			}
+		}
+	}
+	return fmt.Errorf("manifest entry disappeared between planning and apply")
+}
+
+// applyMySQL mirrors mysqlDriver.Detect(), using the manifest entry's
+// fields instead of global flags, so -f behaves identically to
+// 'pmm-admin add mysql' with the same options.
+func applyMySQL(e ManifestMySQL) error {
+	userDSN := dsn.DSN{
+		DefaultsFile: e.DefaultsFile,
+		Username:     e.User,
+		Password:     e.Password,
+		Hostname:     e.Host,
+		Port:         e.Port,
+		Socket:       e.Socket,
+	}
+	userDSN, err := userDSN.AutoDetect()
+	if err != nil && err != dsn.ErrNoSocket {
+		return fmt.Errorf("cannot auto-detect MySQL: %s", err)
+	}
+
+	maxUserConn := e.MaxUserConn
+	if maxUserConn == 0 {
+		maxUserConn = flagMySQLMaxUserConn
+	}
+	mc := pmm.NewMySQLConn(userDSN, e.AgentUser, e.AgentPassword, e.OldPasswords, maxUserConn)
+	agentDSN, err := mc.AgentDSN()
+	if err != nil {
+		return err
+	}
+
+	info, err := mc.Info(agentDSN)
+	if err != nil {
+		return err
+	}
+
+	source := e.QuerySource
+	if source == "" {
+		source = "auto"
+	}
+	if source == "auto" {
+		if info["hostname"] == api.Hostname() {
+			source = "slowlog"
+		} else {
+			source = "perfschema"
+		}
+	}
+
+	return admin.AddMySQL(e.Name, agentDSN.String(), source, manifestStart(e.Start), info)
+}
+
+func applyPostgreSQL(e ManifestPostgreSQL) error {
+	userDSN := pmm.PostgreSQLDSN{
+		Username: e.User,
+		Password: e.Password,
+		Hostname: e.Host,
+		Port:     e.Port,
+		SSLMode:  e.SSLMode,
+	}
+	p := pmm.NewPostgreSQLConn(userDSN, "", "")
+	agentDSN, err := p.AgentDSN()
+	if err != nil {
+		return err
+	}
+	info, err := p.Info(agentDSN)
+	if err != nil {
+		return err
+	}
+	return admin.AddPostgreSQL(e.Name, agentDSN.String(), manifestStart(e.Start), info)
+}
+
+func applyProxySQL(e ManifestProxySQL) error {
+	adminDSN := pmm.ProxySQLDSN{
+		Username: e.User,
+		Password: e.Password,
+		Hostname: e.Host,
+		Port:     e.Port,
+	}
+	p := pmm.NewProxySQLConn(adminDSN)
+	if err := p.TestConnection(); err != nil {
+		return err
+	}
+	info, err := p.Info()
+	if err != nil {
+		return err
+	}
+	return admin.AddProxySQL(e.Name, adminDSN.String(), manifestStart(e.Start), info)
+}
+
+func applyRemove(instanceType, name string) error {
+	switch instanceType {
+	case "mysql":
+		return admin.RemoveMySQL(name)
+	case "mongodb":
+		return admin.RemoveMongoDB(name)
+	case "postgresql":
+		return admin.RemovePostgreSQL(name)
+	case "proxysql":
+		return admin.RemoveProxySQL(name)
+	}
+	return fmt.Errorf("unknown instance type: %s", instanceType)
+}
+
+func manifestStart(start *bool) bool {
+	if start == nil {
+		return true
+	}
+	return *start
+}
+
+// printPlan prints the actions a (real or -dry-run) apply will take/took.
+func printPlan(format output.Format, actions []applyAction) {
+	if format != output.Text {
+		printResult(format, actions)
+		return
+	}
+	if len(actions) == 0 {
+		fmt.Println("Nothing to do.")
+		return
+	}
+	for _, a := range actions {
+		sign := "+"
+		switch a.Action {
+		case "remove":
+			sign = "-"
+		case "update":
+			sign = "~"
+		}
+		fmt.Printf("%s %s %s %s\n", sign, a.Action, a.Type, a.Name)
+	}
+}
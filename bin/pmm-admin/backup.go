@@ -0,0 +1,162 @@
+/*
+	Copyright (c) 2016, Percona LLC and/or its affiliates. All rights reserved.
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/percona/pmm-admin/output"
+)
+
+// handleBackup dispatches "pmm-admin backup <add|run|list|remove> ...".
+func handleBackup(format output.Format, args []string) {
+	if len(args) < 2 {
+		fmt.Println("Usage: pmm-admin backup <add|run|list|remove|export> ... See 'pmm-admin help backup'.")
+		os.Exit(1)
+	}
+
+	switch args[1] {
+	case "add":
+		if len(args) < 5 {
+			fmt.Println("Usage: pmm-admin backup add <name> <cron> <destination> [retention]")
+			os.Exit(1)
+		}
+		name, cron, destination := args[2], args[3], args[4]
+		retention := ""
+		if len(args) > 5 {
+			retention = args[5]
+		}
+		if err := admin.AddBackupSchedule(name, cron, destination, retention); err != nil {
+			emitError(format, fmt.Sprintf("Error adding backup schedule: %s\n", err), err)
+		}
+		if format != output.Text {
+			printResult(format, output.AddResult{Status: "scheduled", Type: "backup", Name: name})
+			return
+		}
+		fmt.Printf("OK, scheduled backups for %s (%s) to %s\n", name, cron, destination)
+
+	case "run":
+		if len(args) != 3 {
+			fmt.Println("Usage: pmm-admin backup run <name>")
+			os.Exit(1)
+		}
+		name := args[2]
+		if err := admin.RunBackupNow(name); err != nil {
+			emitError(format, fmt.Sprintf("Error running backup: %s\n", err), err)
+		}
+		if format != output.Text {
+			printResult(format, output.AddResult{Status: "completed", Type: "backup", Name: name})
+			return
+		}
+		fmt.Printf("OK, backup of %s completed\n", name)
+
+	case "list", "ls":
+		name := ""
+		if len(args) > 2 {
+			name = args[2]
+		}
+		jobs, err := admin.ListBackups(name)
+		if err != nil {
+			emitError(format, fmt.Sprintf("Error getting backups: %s\n", err), err)
+		}
+		if format != output.Text {
+			printResult(format, jobs)
+			return
+		}
+		if len(jobs) == 0 {
+			fmt.Println("No backup schedules.")
+			return
+		}
+		linefmt := "%-20s %-20s %-30s %s\n"
+		fmt.Printf(linefmt, "NAME", "SCHEDULE", "DESTINATION", "LAST STATUS")
+		for _, job := range jobs {
+			last := "scheduled, not yet run"
+			if job.Completed {
+				last = "failed: " + job.LastStatus
+				if job.Succeeded {
+					last = "succeeded"
+				}
+			}
+			fmt.Printf(linefmt, job.Name, job.Schedule, job.Destination, last)
+		}
+
+	case "export":
+		if len(args) != 3 {
+			fmt.Println("Usage: pmm-admin backup export <file> (with -storage-endpoint, an S3 object key instead of a file)")
+			os.Exit(1)
+		}
+		dest := args[2]
+		var buf bytes.Buffer
+		if err := admin.Export(&buf); err != nil {
+			emitError(format, fmt.Sprintf("Error exporting: %s\n", err), err)
+		}
+		if err := writeManifest(dest, buf.Bytes()); err != nil {
+			emitError(format, fmt.Sprintf("Error writing %s: %s\n", dest, err), err)
+		}
+		if format != output.Text {
+			printResult(format, output.AddResult{Status: "exported", Type: "backup-manifest", Name: dest})
+			return
+		}
+		fmt.Printf("OK, exported Consul registrations and backup schedules to %s\n", dest)
+
+	case "remove", "rm":
+		if len(args) != 3 {
+			fmt.Println("Usage: pmm-admin backup remove <name>")
+			os.Exit(1)
+		}
+		name := args[2]
+		if err := admin.RemoveBackupSchedule(name); err != nil {
+			emitError(format, fmt.Sprintf("Error removing backup schedule: %s\n", err), err)
+		}
+		if format != output.Text {
+			printResult(format, output.RemoveResult{Status: "removed", Type: "backup", Name: name})
+			return
+		}
+		fmt.Printf("OK, removed backup schedule for %s\n", name)
+
+	default:
+		fmt.Printf("Unknown 'backup' subcommand: %s\n", strings.Join(args[1:], " "))
+		os.Exit(1)
+	}
+}
+
+// backupUsage is printed by 'pmm-admin help backup'.
+func backupUsage() {
+	fmt.Printf("Usage: pmm-admin backup <add|run|list|remove|export> ...\n\n" +
+		"  backup add <name> <cron> <destination> [retention]\n" +
+		"      Schedule xtrabackup runs for MySQL instance <name>. <destination>\n" +
+		"      is an s3://, file://, or gs:// URL.\n" +
+		"  backup run <name>\n" +
+		"      Run <name>'s backup immediately, outside its schedule.\n" +
+		"  backup list [name]\n" +
+		"      List backup schedules and their last run status, optionally\n" +
+		"      filtered to one MySQL instance.\n" +
+		"  backup remove <name>\n" +
+		"      Remove <name>'s backup schedule.\n" +
+		"  backup export <file>\n" +
+		"      Snapshot this host's Consul registrations and backup schedules\n" +
+		"      into a JSON manifest, for disaster recovery; see 'pmm-admin help\n" +
+		"      restore'.\n" +
+		"\nRequires the local agent to support the /backups endpoint.\n\n" +
+		"'export' (and 'restore') write/read <file> locally, or as an object in" +
+		" an S3-compatible bucket if -storage-endpoint, -access-key, -secret-key," +
+		" and -bucket are set (-use-ssl for HTTPS).\n")
+}
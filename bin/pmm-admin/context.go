@@ -0,0 +1,96 @@
+/*
+	Copyright (c) 2016, Percona LLC and/or its affiliates. All rights reserved.
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// handleContext dispatches "pmm-admin context <list|use|add|remove> ...".
+func handleContext(args []string) {
+	if len(args) < 2 {
+		fmt.Println("Usage: pmm-admin context <list|use|add|remove> ... See 'pmm-admin help context'.")
+		os.Exit(1)
+	}
+
+	switch args[1] {
+	case "list", "ls":
+		names, current := admin.ListContexts()
+		if len(names) == 0 {
+			fmt.Println("No contexts. Run 'pmm-admin context add <name> <server address>'.")
+			return
+		}
+		for _, name := range names {
+			marker := "  "
+			if name == current {
+				marker = "* "
+			}
+			fmt.Println(marker + name)
+		}
+
+	case "use":
+		if len(args) != 3 {
+			fmt.Println("Usage: pmm-admin context use <name>")
+			os.Exit(1)
+		}
+		if err := admin.UseContext(args[2]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("OK, now using context %s\n", args[2])
+
+	case "add":
+		if len(args) != 4 {
+			fmt.Println("Usage: pmm-admin context add <name> <server address[:port]>")
+			os.Exit(1)
+		}
+		if err := admin.AddContext(args[2], args[3]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("OK, added and switched to context %s (%s)\n", args[2], args[3])
+
+	case "remove", "rm":
+		if len(args) != 3 {
+			fmt.Println("Usage: pmm-admin context remove <name>")
+			os.Exit(1)
+		}
+		if err := admin.RemoveContext(args[2]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("OK, removed context %s\n", args[2])
+
+	default:
+		fmt.Printf("Unknown 'context' subcommand: %s\n", args[1])
+		os.Exit(1)
+	}
+}
+
+// contextUsage is printed by 'pmm-admin help context'.
+func contextUsage() {
+	fmt.Printf("Usage: pmm-admin context <list|use|add|remove> ...\n\n" +
+		"  context list             List configured contexts; '*' marks the current one\n" +
+		"  context use <name>       Switch the current context\n" +
+		"  context add <name> <server address[:port]>\n" +
+		"                           Add a context for another PMM server and switch to it\n" +
+		"  context remove <name>    Remove a context (not the current one)\n\n" +
+		"Every other command honors '-context <name>' to run against a context" +
+		" other than the current one for a single invocation, without switching it.\n")
+}
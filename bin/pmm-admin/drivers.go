@@ -0,0 +1,246 @@
+/*
+	Copyright (c) 2016, Percona LLC and/or its affiliates. All rights reserved.
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/percona/go-mysql/dsn"
+	pmm "github.com/percona/pmm-admin"
+)
+
+// InstanceDriver is implemented by every "pmm-admin add <type>" instance
+// type that is identified by a DSN rather than a plain address (unlike
+// "os", which takes a bare [address] arg and is handled separately).
+type InstanceDriver interface {
+	// Name is the "pmm-admin add <type>" instance type this driver handles.
+	Name() string
+
+	// Detect gathers the DSN, instance name, and info (distro, version, ...)
+	// needed to add the instance, creating an agent user/role if needed.
+	// It prints its own progress/error messages, same as the inline code
+	// it replaces, and returns ok=false if it already os.Exit'd or printed
+	// a fatal error.
+	// maskedDSN is the same DSN with the password redacted, safe to print.
+	Detect() (name, dsn, maskedDSN string, info map[string]string, ok bool)
+
+	// Add registers and, if start, starts monitoring the instance.
+	Add(admin *pmm.Admin, name, dsn string, start bool, info map[string]string) error
+
+	// Remove stops monitoring the instance.
+	Remove(admin *pmm.Admin, name string) error
+}
+
+// instanceDrivers is the registry of non-"os" instance types. main()
+// dispatches "add"/"remove" through this map instead of a hardcoded switch.
+var instanceDrivers = map[string]InstanceDriver{}
+
+func registerInstanceDriver(d InstanceDriver) {
+	instanceDrivers[d.Name()] = d
+}
+
+// -- MySQL --------------------------------------------------------------
+
+type mysqlDriver struct{}
+
+func (mysqlDriver) Name() string { return "mysql" }
+
+func (mysqlDriver) Detect() (string, string, string, map[string]string, bool) {
+	if admin.ClientAddress() == "" {
+		fmt.Printf("Add OS first to set client address by running 'pmm-admin add os <address>'\n")
+		os.Exit(0)
+	}
+	userDSN := dsn.DSN{
+		DefaultsFile: flagMySQLDefaultsFile,
+		Username:     flagMySQLUser,
+		Password:     flagMySQLPass,
+		Hostname:     flagMySQLHost,
+		Port:         flagMySQLPort,
+		Socket:       flagMySQLSocket,
+	}
+	userDSN, err := userDSN.AutoDetect()
+	if err != nil && err != dsn.ErrNoSocket {
+		fmt.Printf("Cannot auto-detect MySQL: %s. The command will probably fail...\n", err)
+	}
+	m := pmm.NewMySQLConn(userDSN, flagAgentUser, flagAgentPass, flagMySQLOldPasswords, flagMySQLMaxUserConn)
+
+	if flagMySQLInitFile != "" {
+		agentDSN, err := m.AgentInitFile(flagMySQLInitFile)
+		if err != nil {
+			fmt.Printf("Cannot write MySQL init-file %s: %s\n", flagMySQLInitFile, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote MySQL agent grants to %s. Copy it to the MySQL server's init-file,"+
+			" restart MySQL, then re-run this command with -agent-user=%s -agent-password=%s"+
+			" (and without -mysql-init-file) to finish adding the instance.\n",
+			flagMySQLInitFile, agentDSN.Username, agentDSN.Password)
+		os.Exit(0)
+	}
+
+	agentDSN, err := m.AgentDSN()
+	if err != nil {
+		fmt.Println("Auto-detected MySQL", dsn.HidePassword(userDSN.String()))
+		if flagAgentUser == "" {
+			fmt.Printf("Cannot create MySQL user for agent: %s. Use MySQL options (-user, -password, etc.)"+
+				" to specify a MySQL user with GRANT privileges. Or, use options -agent-user and -agent-password"+
+				" to specify an existing agent MySQL user. Or, use -mysql-init-file to write the grants to a file"+
+				" for a read-only/containerized MySQL.\n", err)
+		} else {
+			fmt.Printf("Cannot connect to MySQL using the given -agent-user and -agent-password: %s."+
+				" Verify that the agent MySQL user exists and has the correct privileges. Specify additional"+
+				" MySQL options (-host, -port, -socket, etc.) if needed.", err)
+		}
+		os.Exit(1)
+	}
+
+	info, err := m.Info(agentDSN)
+	if err != nil {
+		fmt.Printf("Cannot get MySQL info: %s\n", err)
+		os.Exit(1)
+	}
+
+	if flagQuerySource == "auto" {
+		if info["hostname"] == api.Hostname() {
+			flagQuerySource = "slowlog"
+		} else {
+			flagQuerySource = "perfschema"
+		}
+	}
+
+	name := info["hostname"]
+	if info["port"] != "3306" {
+		name += ":" + info["port"]
+	}
+
+	return name, agentDSN.String(), dsn.HidePassword(agentDSN.String()), info, true
+}
+
+func (mysqlDriver) Add(admin *pmm.Admin, name, agentDSN string, start bool, info map[string]string) error {
+	return admin.AddMySQL(name, agentDSN, flagQuerySource, start, info)
+}
+
+func (mysqlDriver) Remove(admin *pmm.Admin, name string) error {
+	return admin.RemoveMySQL(name)
+}
+
+// -- PostgreSQL -----------------------------------------------------------
+
+type postgresqlDriver struct{}
+
+func (postgresqlDriver) Name() string { return "postgresql" }
+
+func (postgresqlDriver) Detect() (string, string, string, map[string]string, bool) {
+	if admin.ClientAddress() == "" {
+		fmt.Printf("Add OS first to set client address by running 'pmm-admin add os <address>'\n")
+		os.Exit(0)
+	}
+	userDSN := pmm.PostgreSQLDSN{
+		Username: flagPgUser,
+		Password: flagMySQLPass, // -password is shared across instance types, like MySQL's
+		Hostname: flagPgHost,
+		Port:     flagPgPort,
+		SSLMode:  flagPgSSLMode,
+	}
+	p := pmm.NewPostgreSQLConn(userDSN, flagAgentUser, flagAgentPass)
+	agentDSN, err := p.AgentDSN()
+	if err != nil {
+		fmt.Printf("Cannot create PostgreSQL user for agent: %s. Use -pg-user/-password or -agent-user/-agent-password.\n", err)
+		os.Exit(1)
+	}
+
+	info, err := p.Info(agentDSN)
+	if err != nil {
+		fmt.Printf("Cannot get PostgreSQL info: %s\n", err)
+		os.Exit(1)
+	}
+
+	name := userDSN.Hostname
+	if userDSN.Port != "" && userDSN.Port != "5432" {
+		name += ":" + userDSN.Port
+	}
+
+	masked := agentDSN
+	masked.Password = "***"
+	return name, agentDSN.String(), masked.String(), info, true
+}
+
+func (postgresqlDriver) Add(admin *pmm.Admin, name, dsn string, start bool, info map[string]string) error {
+	return admin.AddPostgreSQL(name, dsn, start, info)
+}
+
+func (postgresqlDriver) Remove(admin *pmm.Admin, name string) error {
+	return admin.RemovePostgreSQL(name)
+}
+
+// -- ProxySQL ---------------------------------------------------------------
+
+type proxysqlDriver struct{}
+
+func (proxysqlDriver) Name() string { return "proxysql" }
+
+func (proxysqlDriver) Detect() (string, string, string, map[string]string, bool) {
+	if admin.ClientAddress() == "" {
+		fmt.Printf("Add OS first to set client address by running 'pmm-admin add os <address>'\n")
+		os.Exit(0)
+	}
+	adminDSN := pmm.ProxySQLDSN{
+		Username: flagProxySQLUser,
+		Password: flagProxySQLPass,
+		Hostname: flagProxySQLHost,
+		Port:     flagProxySQLPort,
+	}
+	p := pmm.NewProxySQLConn(adminDSN)
+	if err := p.TestConnection(); err != nil {
+		fmt.Printf("Cannot connect to ProxySQL admin interface: %s\n", err)
+		os.Exit(1)
+	}
+
+	info, err := p.Info()
+	if err != nil {
+		fmt.Printf("Cannot get ProxySQL info: %s\n", err)
+		os.Exit(1)
+	}
+
+	name := adminDSN.Hostname
+	if adminDSN.Port != "" && adminDSN.Port != pmm.DEFAULT_PROXYSQL_ADMIN_PORT {
+		name += ":" + adminDSN.Port
+	}
+
+	masked := adminDSN
+	masked.Password = "***"
+	return name, adminDSN.String(), masked.String(), info, true
+}
+
+func (proxysqlDriver) Add(admin *pmm.Admin, name, dsn string, start bool, info map[string]string) error {
+	return admin.AddProxySQL(name, dsn, start, info)
+}
+
+func (proxysqlDriver) Remove(admin *pmm.Admin, name string) error {
+	return admin.RemoveProxySQL(name)
+}
+
+func init() {
+	for _, d := range []InstanceDriver{
+		mysqlDriver{},
+		postgresqlDriver{},
+		proxysqlDriver{},
+	} {
+		registerInstanceDriver(d)
+	}
+}
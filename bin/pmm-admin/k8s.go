@@ -0,0 +1,80 @@
+/*
+	Copyright (c) 2016, Percona LLC and/or its affiliates. All rights reserved.
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	pmm "github.com/percona/pmm-admin"
+	"github.com/percona/pmm-admin/pkg/pmm/k8s"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// runK8sController builds an in-cluster Kubernetes client and runs
+// pkg/pmm/k8s.Controller until it's interrupted. It's only meant to run
+// as a pod inside the cluster it watches, so it always uses the in-cluster
+// config rather than taking a -kubeconfig flag.
+func runK8sController(admin *pmm.Admin) error {
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		return fmt.Errorf("k8s-controller must run inside the cluster it watches: %s", err)
+	}
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("building Kubernetes client: %s", err)
+	}
+
+	identity, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("getting hostname for leader election identity: %s", err)
+	}
+
+	ctrl := k8s.NewController(admin, client, k8s.Options{
+		Namespace:      flagK8sNamespace,
+		LeaseName:      flagK8sLeaseName,
+		LeaseNamespace: currentNamespace(),
+		Identity:       identity,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	return ctrl.Run(ctx)
+}
+
+// currentNamespace returns this pod's own namespace, from the
+// ServiceAccount volume every pod gets mounted, falling back to
+// "default" if it's somehow missing (e.g. running outside a pod).
+func currentNamespace() string {
+	data, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+	if err != nil {
+		return "default"
+	}
+	return string(data)
+}
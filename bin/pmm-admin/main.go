@@ -18,13 +18,15 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
-	"github.com/percona/go-mysql/dsn"
 	pmm "github.com/percona/pmm-admin"
+	"github.com/percona/pmm-admin/output"
 )
 
 const (
@@ -39,6 +41,7 @@ var (
 	flagMySQLPort         string
 	flagMySQLSocket       string
 	flagMySQLDefaultsFile string
+	flagMySQLInitFile     string
 	flagQuerySource       string
 	flagMySQLOldPasswords bool
 	flagMySQLMaxUserConn  int64
@@ -49,10 +52,80 @@ var (
 	flagMongoCluster      string
 	flagVersion           bool
 	flagStart             bool
+	flagFormat            string
+
+	flagServerInsecureTLS bool
+	flagServerCA          string
+	flagServerToken       string
+
+	flagConsulToken       string
+	flagConsulInsecureTLS bool
+	flagConsulCA          string
+	flagConsulClientCert  string
+	flagConsulClientKey   string
+
+	flagCheckInterval        string
+	flagCheckTimeout         string
+	flagCheckDeregisterAfter string
+
+	flagPgUser    string
+	flagPgHost    string
+	flagPgPort    string
+	flagPgSSLMode string
+
+	flagProxySQLUser string
+	flagProxySQLPass string
+	flagProxySQLHost string
+	flagProxySQLPort string
+
+	flagAPITimeout       time.Duration
+	flagAPIRetries       int
+	flagAPIRetryMaxDelay time.Duration
+
+	flagApplyFile string
+	flagDryRun    bool
+	flagPrune     bool
+
+	flagK8sNamespace string
+	flagK8sLeaseName string
+
+	flagServicesNode        string
+	flagServicesJob         string
+	flagServicesConcurrency int
+
+	flagStorageEndpoint string
+	flagAccessKey       string
+	flagSecretKey       string
+	flagBucket          string
+	flagUseSSL          bool
+
+	flagOTLPEndpoint   string
+	flagOTLPSampleRate float64
+	flagMetricsAddr    string
+
+	flagContext string
 )
 
 var fs *flag.FlagSet
 
+// flagsSet records which flags were actually passed on the command
+// line this invocation (populated via fs.Visit right after fs.Parse),
+// as opposed to merely holding their zero-value/default. Several flags
+// (server/Consul auth, check config, telemetry) are persisted into the
+// config file by commands that run on every invocation (server, apply,
+// k8s-controller); without this, an unset flag's default would silently
+// overwrite whatever was saved the last time it WAS set. See
+// resolveServerAuth and friends below.
+var flagsSet = map[string]bool{}
+
+// admin and api are set up once in main() and read by the InstanceDriver
+// implementations in drivers.go, which run as part of the same single
+// command invocation.
+var (
+	admin *pmm.Admin
+	api   *pmm.API
+)
+
 func init() {
 	fs = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 
@@ -64,6 +137,8 @@ func init() {
 	fs.StringVar(&flagMySQLPort, "port", "", "MySQL port")
 	fs.StringVar(&flagMySQLSocket, "socket", "", "MySQL socket file")
 	fs.StringVar(&flagMySQLDefaultsFile, "defaults-file", "", "Path to my.cnf")
+	fs.StringVar(&flagMySQLInitFile, "mysql-init-file", "", "Write agent user grants to this file instead of"+
+		" running them, for read-only/containerized MySQL; apply it as MySQL's init-file and re-run without this flag")
 
 	fs.StringVar(&flagAgentUser, "agent-user", "", "Existing database username for agent")
 	fs.StringVar(&flagAgentPass, "agent-password", "", "Existing database password for agent")
@@ -78,6 +153,142 @@ func init() {
 
 	fs.BoolVar(&flagVersion, "version", false, "Print version")
 	fs.BoolVar(&flagStart, "start", true, "Start monitoring instance after add")
+	fs.StringVar(&flagFormat, "format", "text", "Output format for list/add/remove: text, json, yaml")
+
+	fs.BoolVar(&flagServerInsecureTLS, "server-insecure-tls", false, "Use HTTPS to talk to the PMM server without verifying its certificate")
+	fs.StringVar(&flagServerCA, "server-ca", "", "Path to the PMM server's CA bundle, for HTTPS with a self-signed cert")
+	fs.StringVar(&flagServerToken, "server-token", "", "API key/token for PMM servers that require authentication")
+
+	fs.StringVar(&flagConsulToken, "consul-token", "", "ACL token for a secured Consul cluster, sent as X-Consul-Token"+
+		" (falls back to $CONSUL_HTTP_TOKEN if not set here or already saved)")
+	fs.BoolVar(&flagConsulInsecureTLS, "consul-insecure-tls", false, "Use HTTPS to talk to Consul without verifying its certificate")
+	fs.StringVar(&flagConsulCA, "consul-ca", "", "Path to Consul's CA bundle, for HTTPS with a self-signed cert (falls back to $CONSUL_CACERT)")
+	fs.StringVar(&flagConsulClientCert, "consul-client-cert", "", "Path to a client cert for Consul mTLS (falls back to $CONSUL_CLIENT_CERT)")
+	fs.StringVar(&flagConsulClientKey, "consul-client-key", "", "Path to the client cert's key (falls back to $CONSUL_CLIENT_KEY)")
+
+	fs.StringVar(&flagCheckInterval, "check-interval", pmm.DefaultCheckInterval, "Interval between Consul health checks on registered services")
+	fs.StringVar(&flagCheckTimeout, "check-timeout", pmm.DefaultCheckTimeout, "Timeout for each Consul health check")
+	fs.StringVar(&flagCheckDeregisterAfter, "check-deregister-after", pmm.DefaultCheckDeregisterCriticalAfter, "Deregister a service if its check stays critical this long")
+
+	fs.StringVar(&flagPgUser, "pg-user", "", "PostgreSQL username")
+	fs.StringVar(&flagPgHost, "pg-host", "", "PostgreSQL host")
+	fs.StringVar(&flagPgPort, "pg-port", "5432", "PostgreSQL port")
+	fs.StringVar(&flagPgSSLMode, "pg-sslmode", "disable", "PostgreSQL SSL mode")
+
+	fs.StringVar(&flagProxySQLUser, "proxysql-user", "admin", "ProxySQL admin interface username")
+	fs.StringVar(&flagProxySQLPass, "proxysql-password", "admin", "ProxySQL admin interface password")
+	fs.StringVar(&flagProxySQLHost, "proxysql-host", "localhost", "ProxySQL admin interface host")
+	fs.StringVar(&flagProxySQLPort, "proxysql-port", pmm.DEFAULT_PROXYSQL_ADMIN_PORT, "ProxySQL admin interface port")
+
+	fs.DurationVar(&flagAPITimeout, "api-timeout", pmm.DefaultAPITimeout, "Timeout for each API request")
+	fs.IntVar(&flagAPIRetries, "api-retries", pmm.DefaultRetryMaxAttempts, "Max attempts per API request before giving up")
+	fs.DurationVar(&flagAPIRetryMaxDelay, "api-retry-max-delay", pmm.DefaultRetryMaxDelay, "Max backoff delay between API request retries")
+
+	fs.StringVar(&flagApplyFile, "f", "", "Manifest file for 'apply'")
+	fs.BoolVar(&flagDryRun, "dry-run", false, "With 'apply' or 'services cp/rm', print the plan without changing anything")
+	fs.BoolVar(&flagPrune, "prune", false, "With 'apply', remove instances not present in the manifest")
+
+	fs.StringVar(&flagK8sNamespace, "k8s-namespace", "", "With 'k8s-controller', restrict watching to this namespace (default all namespaces)")
+	fs.StringVar(&flagK8sLeaseName, "k8s-lease-name", "pmm-admin-k8s-controller", "With 'k8s-controller', Lease name used for leader election between replicas")
+
+	fs.StringVar(&flagServicesNode, "node", "", "With 'services ls', restrict to nodes matching this glob (e.g. 'db-*')")
+	fs.StringVar(&flagServicesJob, "job", "", "With 'services cp/rm', comma-separated jobs to act on (default: every job)")
+	fs.IntVar(&flagServicesConcurrency, "services-concurrency", pmm.DefaultServicesConcurrency, "With 'services ls', max nodes to query at once")
+
+	fs.StringVar(&flagStorageEndpoint, "storage-endpoint", "", "With 'backup export'/'restore', S3-compatible endpoint to read/write <file> from instead of the local disk")
+	fs.StringVar(&flagAccessKey, "access-key", "", "Access key for -storage-endpoint")
+	fs.StringVar(&flagSecretKey, "secret-key", "", "Secret key for -storage-endpoint")
+	fs.StringVar(&flagBucket, "bucket", "", "Bucket for -storage-endpoint")
+	fs.BoolVar(&flagUseSSL, "use-ssl", false, "Use HTTPS to talk to -storage-endpoint")
+
+	fs.StringVar(&flagOTLPEndpoint, "otlp-endpoint", "", "Host:port of an OTLP gRPC collector to send API request traces to (default: tracing off)")
+	fs.Float64Var(&flagOTLPSampleRate, "otlp-sample-rate", 1, "Fraction of requests to trace, in (0, 1]")
+	fs.StringVar(&flagMetricsAddr, "metrics-addr", ":42002", "With 'metrics-server', address to serve Prometheus metrics on")
+
+	fs.StringVar(&flagContext, "context", "", "Use this context instead of the current one (see 'pmm-admin context')")
+}
+
+// loadConfig loads flagConfig into admin and applies -context, called
+// both at startup and after any command (like 'apply'/'add os') that
+// bootstraps the config file mid-run and needs to re-read it.
+func loadConfig() {
+	if err := admin.LoadConfig(flagConfig); err != nil {
+		fmt.Printf("Error reading %s: %s\n", flagConfig, err)
+		os.Exit(1)
+	}
+	admin.UseCurrentContext(flagContext)
+}
+
+// resolveServerAuth merges this invocation's -server-* flags with
+// whatever is already persisted: an unset flag keeps its saved value
+// instead of resetting to the flag's own default. Called everywhere
+// SetServerAuth is (server/apply/k8s-controller all re-apply it on
+// every run).
+func resolveServerAuth() (insecureTLS bool, caFile, token string) {
+	insecureTLS, caFile, token = flagServerInsecureTLS, flagServerCA, flagServerToken
+	curInsecureTLS, curCA, curToken := admin.ServerAuth()
+	if !flagsSet["server-insecure-tls"] {
+		insecureTLS = curInsecureTLS
+	}
+	if !flagsSet["server-ca"] {
+		caFile = curCA
+	}
+	if !flagsSet["server-token"] {
+		token = curToken
+	}
+	return
+}
+
+// resolveConsulAuth is resolveServerAuth's counterpart for -consul-*.
+func resolveConsulAuth() (token string, insecureTLS bool, caFile, certFile, keyFile string) {
+	token, insecureTLS, caFile, certFile, keyFile = flagConsulToken, flagConsulInsecureTLS, flagConsulCA, flagConsulClientCert, flagConsulClientKey
+	curToken, curInsecureTLS, curCA, curCert, curKey := admin.ConsulAuth()
+	if !flagsSet["consul-token"] {
+		token = curToken
+	}
+	if !flagsSet["consul-insecure-tls"] {
+		insecureTLS = curInsecureTLS
+	}
+	if !flagsSet["consul-ca"] {
+		caFile = curCA
+	}
+	if !flagsSet["consul-client-cert"] {
+		certFile = curCert
+	}
+	if !flagsSet["consul-client-key"] {
+		keyFile = curKey
+	}
+	return
+}
+
+// resolveCheckConfig is resolveServerAuth's counterpart for -check-*.
+func resolveCheckConfig() (interval, timeout, deregisterAfter string) {
+	interval, timeout, deregisterAfter = flagCheckInterval, flagCheckTimeout, flagCheckDeregisterAfter
+	curInterval, curTimeout, curDeregisterAfter := admin.CheckConfig()
+	if !flagsSet["check-interval"] {
+		interval = curInterval
+	}
+	if !flagsSet["check-timeout"] {
+		timeout = curTimeout
+	}
+	if !flagsSet["check-deregister-after"] {
+		deregisterAfter = curDeregisterAfter
+	}
+	return
+}
+
+// resolveTelemetryConfig is resolveServerAuth's counterpart for
+// -otlp-*.
+func resolveTelemetryConfig() (otlpEndpoint string, sampleRate float64) {
+	otlpEndpoint, sampleRate = flagOTLPEndpoint, flagOTLPSampleRate
+	cur := admin.TelemetryOptions()
+	if !flagsSet["otlp-endpoint"] {
+		otlpEndpoint = cur.OTLPEndpoint
+	}
+	if !flagsSet["otlp-sample-rate"] {
+		sampleRate = cur.SampleRate
+	}
+	return
 }
 
 func main() {
@@ -94,6 +305,7 @@ func main() {
 			os.Exit(1)
 		}
 	}
+	fs.Visit(func(f *flag.Flag) { flagsSet[f.Name] = true })
 
 	// Check for invalid mix of options.
 	if flagMySQLSocket != "" && flagMySQLHost != "" {
@@ -112,6 +324,11 @@ func main() {
 		fmt.Printf("-agent-user and -agent-password are both required when either one is specified")
 		os.Exit(1)
 	}
+	format, err := output.ParseFormat(flagFormat)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
 	args := fs.Args()
 
@@ -125,10 +342,10 @@ func main() {
 		os.Exit(0)
 	}
 
-	admin := pmm.NewAdmin()
-	if err := admin.LoadConfig(flagConfig); err != nil {
-		fmt.Printf("Error reading %s: %s\n", flagConfig, err)
-		os.Exit(1)
+	admin = pmm.NewAdmin()
+	loadConfig()
+	if _, err := pmm.InitTelemetry(admin.TelemetryOptions()); err != nil {
+		fmt.Printf("Warning: telemetry not started: %s\n", err)
 	}
 
 	// First arg is the command.
@@ -144,10 +361,148 @@ func main() {
 			fmt.Printf("Error setting %s: %s\n", cmd, err)
 			os.Exit(1)
 		}
+		if err := admin.SetServerAuth(resolveServerAuth()); err != nil {
+			fmt.Printf("Error setting server auth: %s\n", err)
+			os.Exit(1)
+		}
+		if err := admin.SetConsulAuth(resolveConsulAuth()); err != nil {
+			fmt.Printf("Error setting Consul auth: %s\n", err)
+			os.Exit(1)
+		}
+		if err := admin.SetCheckConfig(resolveCheckConfig()); err != nil {
+			fmt.Printf("Error setting check config: %s\n", err)
+			os.Exit(1)
+		}
+		if err := admin.SetTelemetryConfig(resolveTelemetryConfig()); err != nil {
+			fmt.Printf("Error setting telemetry config: %s\n", err)
+			os.Exit(1)
+		}
 		fmt.Printf("OK, %s is %s\n", cmd, addr)
 		os.Exit(0)
 	}
 
+	// Command 'apply -f <file>' is also special: like 'server' and
+	// 'add os', it's allowed to bootstrap the config file from scratch
+	// (from the manifest's 'server'/'os' instead of separate commands),
+	// since that's the point of giving it a whole manifest at once.
+	if cmd == "apply" {
+		if flagApplyFile == "" {
+			fmt.Println("-f <file> is required. See 'pmm-admin help apply'.")
+			os.Exit(1)
+		}
+		manifest, err := loadManifest(flagApplyFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if admin.Server() == "" {
+			if manifest.Server == "" {
+				fmt.Println("Server address not set and manifest has no 'server'. Run 'pmm-admin server <address[:port]>' first.")
+				os.Exit(1)
+			}
+			if err := admin.SetServer(manifest.Server); err != nil {
+				fmt.Printf("Error setting server: %s\n", err)
+				os.Exit(1)
+			}
+		}
+		if err := admin.SetServerAuth(resolveServerAuth()); err != nil {
+			fmt.Printf("Error setting server auth: %s\n", err)
+			os.Exit(1)
+		}
+
+		apiOpts := admin.APIOptions()
+		apiOpts.Timeout = flagAPITimeout
+		apiOpts.Retry = pmm.RetryPolicy{
+			MaxAttempts: flagAPIRetries,
+			MaxDelay:    flagAPIRetryMaxDelay,
+			Jitter:      true,
+		}
+		api = pmm.NewAPI(nil, apiOpts)
+		admin.SetAPI(api)
+
+		if admin.ClientAddress() == "" {
+			if manifest.OS == nil || manifest.OS.Address == "" {
+				fmt.Println("OS not added and manifest has no 'os.address'. Run 'pmm-admin add os <address>' first.")
+				os.Exit(1)
+			}
+			if err := admin.AddOS(manifest.OS.Address, true, "", ""); err != nil {
+				fmt.Printf("Error adding OS: %s\n", err)
+				os.Exit(1)
+			}
+			loadConfig()
+		}
+
+		current, err := admin.List()
+		if err != nil {
+			emitError(format, fmt.Sprintf("Error getting current inventory: %s\n", err), err)
+		}
+		actions := planApply(manifest, current, flagPrune)
+
+		if flagDryRun {
+			printPlan(format, actions)
+			os.Exit(0)
+		}
+
+		errs := runApply(manifest, actions)
+		printPlan(format, actions)
+		if len(errs) > 0 {
+			for _, err := range errs {
+				fmt.Println(err)
+			}
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Command 'k8s-controller' is also special: it's a long-running daemon,
+	// not a one-shot inventory change, and it never touches this process's
+	// own ClientAddress/ClientUUID since it registers other pods, not this
+	// host (see pkg/pmm/k8s).
+	if cmd == "k8s-controller" {
+		if admin.Server() == "" {
+			fmt.Printf("%s exists but the server address has not been set. Run 'pmm-admin server <address[:port]>'.\n", flagConfig)
+			os.Exit(1)
+		}
+		if err := admin.SetServerAuth(resolveServerAuth()); err != nil {
+			fmt.Printf("Error setting server auth: %s\n", err)
+			os.Exit(1)
+		}
+
+		apiOpts := admin.APIOptions()
+		apiOpts.Timeout = flagAPITimeout
+		apiOpts.Retry = pmm.RetryPolicy{
+			MaxAttempts: flagAPIRetries,
+			MaxDelay:    flagAPIRetryMaxDelay,
+			Jitter:      true,
+		}
+		api = pmm.NewAPI(nil, apiOpts)
+		admin.SetAPI(api)
+
+		if err := runK8sController(admin); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Command 'context' is also special: it manages Config.Contexts
+	// itself, so (unlike every other command) it must work before a
+	// server/context has been configured at all.
+	if cmd == "context" {
+		handleContext(args)
+		os.Exit(0)
+	}
+
+	// Command 'metrics-server' is also special: like 'k8s-controller',
+	// it's a long-running daemon, and it reports on this client's own
+	// requests rather than reading or changing inventory, so it doesn't
+	// need a server address configured at all.
+	if cmd == "metrics-server" {
+		handleMetricsServer()
+		os.Exit(0)
+	}
+
 	// If config file doesn't exist, tell user how to get started.
 	if !pmm.FileExists(flagConfig) {
 		fmt.Printf("%s does not exist. To get started, first run"+
@@ -175,7 +530,14 @@ func main() {
 
 	// Execute the command. Create an API because most commands are just
 	// wrappers around various API calls.
-	api := pmm.NewAPI(nil)
+	apiOpts := admin.APIOptions()
+	apiOpts.Timeout = flagAPITimeout
+	apiOpts.Retry = pmm.RetryPolicy{
+		MaxAttempts: flagAPIRetries,
+		MaxDelay:    flagAPIRetryMaxDelay,
+		Jitter:      true,
+	}
+	api = pmm.NewAPI(nil, apiOpts)
 	admin.SetAPI(api)
 
 	switch cmd {
@@ -184,23 +546,67 @@ func main() {
 	case "list", "ls":
 		list, err := admin.List()
 		if err != nil {
-			fmt.Printf("Error getting list: %s\n", err)
-			os.Exit(1)
+			emitError(format, fmt.Sprintf("Error getting list: %s\n", err), err)
+		}
+		if format != output.Text {
+			var items []output.ListItem
+			for instanceType, instances := range list {
+				for _, in := range instances {
+					items = append(items, output.ListItem{
+						Type:        instanceType,
+						Name:        in.Name,
+						Address:     in.Address,
+						DSNMasked:   in.DSNMasked,
+						Tags:        instanceTags(in),
+						CheckStatus: in.CheckStatus,
+					})
+				}
+			}
+			printResult(format, items)
+			break
 		}
-		linefmt := "%10s %-60s %s\n"
-		fmt.Printf(linefmt, "TYPE", "NAME", "OPTIONS")
-		fmt.Printf(linefmt, strings.Repeat("-", 10), strings.Repeat("-", 60), strings.Repeat("-", 10))
+		linefmt := "%10s %-60s %-10s %-25s %-25s %s\n"
+		fmt.Printf(linefmt, "TYPE", "NAME", "CHECK", "ADDRESS", "DSN", "OPTIONS")
+		fmt.Printf(linefmt, strings.Repeat("-", 10), strings.Repeat("-", 60), strings.Repeat("-", 10), strings.Repeat("-", 25), strings.Repeat("-", 25), strings.Repeat("-", 10))
 		for instanceType, instances := range list {
 			for _, in := range instances {
-				var tags []string
-				if data, ok := in.Tags.([]interface{}); ok {
-					for _, tag := range data {
-						tags = append(tags, tag.(string))
-					}
+				check := in.CheckStatus
+				if check == "" {
+					check = "n/a"
 				}
-				fmt.Printf(linefmt, instanceType, in.Name, strings.Join(tags, ","))
+				fmt.Printf(linefmt, instanceType, in.Name, check, in.Address, in.DSNMasked, strings.Join(instanceTags(in), ","))
 			}
 		}
+	case "check":
+		failing, err := admin.Checks()
+		if err != nil {
+			emitError(format, fmt.Sprintf("Error getting checks: %s\n", err), err)
+		}
+		if format != output.Text {
+			var items []output.CheckResult
+			for service, status := range failing {
+				items = append(items, output.CheckResult{Service: service, Status: status})
+			}
+			printResult(format, items)
+			break
+		}
+		if len(failing) == 0 {
+			fmt.Println("OK, all checks passing.")
+			break
+		}
+		for service, status := range failing {
+			fmt.Printf("%-10s %s\n", status, service)
+		}
+	case "backup":
+		handleBackup(format, args)
+	case "migrate":
+		handleMigrate(format)
+	case "watch":
+		handleWatch()
+	case "services":
+		handleServices(format, args)
+	case "restore":
+		handleRestore(format, args)
 	case "add":
 		if len(args) < 2 {
 			fmt.Printf("Not enough command args: '%s', expected at least 1: 'add <instance type> [address]'\n", strings.Join(args, " "))
@@ -218,97 +624,11 @@ func main() {
 			}
 			addr := args[2]
 			if err := admin.AddOS(addr, flagStart, flagMongoReplSet, flagMongoCluster); err != nil {
-				if err == pmm.ErrHostConflict {
-					hostConflictError("OS", admin.Server())
-				} else {
-					fmt.Printf("Error adding OS: %s\n", err)
-				}
-				os.Exit(1)
-			}
-			if err := admin.LoadConfig(flagConfig); err != nil {
-				fmt.Printf("Now monitoring this OS but error reading %s: %s\n", flagConfig, err)
-				os.Exit(1)
+				addError(format, "OS", err)
 			}
+			loadConfig()
 			os, _ := admin.OS()
-			if flagStart {
-				fmt.Printf("OK, now monitoring this OS as %s\n", os.Name)
-			} else {
-				fmt.Printf("OK, added this OS as %s\n", os.Name)
-			}
-		case "mysql":
-			if admin.ClientAddress() == "" {
-				fmt.Printf("Add OS first to set client address by running 'pmm-admin add os <address>'\n")
-				os.Exit(0)
-			}
-			userDSN := dsn.DSN{
-				DefaultsFile: flagMySQLDefaultsFile,
-				Username:     flagMySQLUser,
-				Password:     flagMySQLPass,
-				Hostname:     flagMySQLHost,
-				Port:         flagMySQLPort,
-				Socket:       flagMySQLSocket,
-			}
-			userDSN, err := userDSN.AutoDetect()
-			if err != nil && err != dsn.ErrNoSocket {
-				fmt.Printf("Cannot auto-detect MySQL: %s. The command will probably fail...\n", err)
-			}
-			m := pmm.NewMySQLConn(userDSN, flagAgentUser, flagAgentPass, flagMySQLOldPasswords, flagMySQLMaxUserConn)
-			agentDSN, err := m.AgentDSN()
-			if err != nil {
-				fmt.Println("Auto-detected MySQL", dsn.HidePassword(userDSN.String()))
-				if flagAgentUser == "" {
-					// Failed trying to create agent MySQL user.
-					fmt.Printf("Cannot create MySQL user for agent: %s. Use MySQL options (-user, -password, etc.)"+
-						" to specify a MySQL user with GRANT privileges. Or, use options -agent-user and -agent-password"+
-						" to specify an existing agent MySQL user.\n", err)
-				} else {
-					// Failed trying to use existing, user-provied agent MySQL user and pass.
-					fmt.Printf("Cannot connect to MySQL using the given -agent-user and -agent-password: %s."+
-						" Verify that the agent MySQL user exists and has the correct privileges. Specify additional"+
-						" MySQL options (-host, -port, -socket, etc.) if needed.", err)
-				}
-				os.Exit(1)
-			}
-
-			// Get MySQL hostname, port, distro, and version. This shouldn't fail
-			// because we just verified the agent MySQL user.
-			info, err := m.Info(agentDSN)
-			if err != nil {
-				fmt.Printf("Cannot get MySQL info: %s\n", err)
-				os.Exit(1)
-			}
-
-			// MySQL is local if the server hostname == MySQL hostname.
-			if flagQuerySource == "auto" {
-				if info["hostname"] == api.Hostname() {
-					flagQuerySource = "slowlog"
-				} else {
-					flagQuerySource = "perfschema"
-				}
-			}
-
-			// We need to name this MySQL instance. Default to its hostname, but
-			// add ":port" if using a non-standard port because it could indicate
-			// that this server is running multiple MySQL instances which requires
-			// they each use a different port.
-			name := info["hostname"]
-			if info["port"] != "3306" {
-				name += ":" + info["port"]
-			}
-
-			if err := admin.AddMySQL(name, agentDSN.String(), flagQuerySource, flagStart, info); err != nil {
-				if err == pmm.ErrHostConflict {
-					hostConflictError("MySQL", admin.Server())
-				} else {
-					fmt.Printf("Error adding MySQL: %s\n", err)
-				}
-				os.Exit(1)
-			}
-			if flagStart {
-				fmt.Printf("OK, now monitoring MySQL %s using DSN %s\n", name, dsn.HidePassword(agentDSN.String()))
-			} else {
-				fmt.Printf("OK, added MySQL %s using DSN %s\n", name, dsn.HidePassword(agentDSN.String()))
-			}
+			printAdded(format, "os", os.Name, "", flagStart, nil)
 		case "mongodb":
 			if admin.ClientAddress() == "" {
 				fmt.Printf("Add OS first to set client address by running 'pmm-admin add os <address>'\n")
@@ -316,20 +636,22 @@ func main() {
 			}
 			node, _ := admin.OS()
 			if err := admin.AddMongoDB(node.Name, flagStart, flagMongoURI, flagMongoReplSet, flagMongoCluster); err != nil {
-				if err == pmm.ErrHostConflict {
-					hostConflictError("MongoDB", admin.Server())
-				} else {
-					fmt.Printf("Error adding MongoDB: %s\n", err)
-				}
+				addError(format, "MongoDB", err)
+			}
+			printAdded(format, "mongodb", node.Name, "", flagStart, nil)
+		default:
+			driver, ok := instanceDrivers[instanceType]
+			if !ok {
+				emitError(format, fmt.Sprintf("Invalid instance type: %s\n", instanceType), fmt.Errorf("invalid instance type: %s", instanceType))
+			}
+			name, detectedDSN, maskedDSN, info, ok := driver.Detect()
+			if !ok {
 				os.Exit(1)
 			}
-			if flagStart {
-				fmt.Printf("OK, now monitoring MongoDB %s\n", node.Name)
-			} else {
-				fmt.Printf("OK, added MongoDB %s\n", node.Name)
+			if err := driver.Add(admin, name, detectedDSN, flagStart, info); err != nil {
+				addError(format, instanceType, err)
 			}
-		default:
-			fmt.Printf("Invalid instance type: %s\n", instanceType)
+			printAdded(format, instanceType, name, maskedDSN, flagStart, info)
 		}
 	case "remove", "rm":
 		if len(args[1:]) != 2 {
@@ -341,24 +663,23 @@ func main() {
 		switch instanceType {
 		case "os":
 			if err := admin.RemoveOS(name); err != nil {
-				fmt.Printf("Error removing OS %s: %s\n", name, err)
-				os.Exit(1)
+				removeError(format, instanceType, name, err)
 			}
-			fmt.Printf("OK, stopped monitoring this OS\n")
-		case "mysql":
-			if err := admin.RemoveMySQL(name); err != nil {
-				fmt.Printf("Error removing MySQL %s: %s\n", name, err)
-				os.Exit(1)
-			}
-			fmt.Printf("OK, stopped monitoring MySQL %s\n", name)
+			printRemoved(format, instanceType, name, "stopped monitoring this OS")
 		case "mongodb":
 			if err := admin.RemoveMongoDB(name); err != nil {
-				fmt.Printf("Error removing MongoDB %s: %s\n", name, err)
-				os.Exit(1)
+				removeError(format, instanceType, name, err)
 			}
-			fmt.Printf("OK, stopped monitoring MongoDB %s\n", name)
+			printRemoved(format, instanceType, name, fmt.Sprintf("stopped monitoring MongoDB %s", name))
 		default:
-			fmt.Printf("Invalid instance type: %s\n", instanceType)
+			driver, ok := instanceDrivers[instanceType]
+			if !ok {
+				emitError(format, fmt.Sprintf("Invalid instance type: %s\n", instanceType), fmt.Errorf("invalid instance type: %s", instanceType))
+			}
+			if err := driver.Remove(admin, name); err != nil {
+				removeError(format, instanceType, name, err)
+			}
+			printRemoved(format, instanceType, name, fmt.Sprintf("stopped monitoring %s %s", instanceType, name))
 		}
 	default:
 		fmt.Printf("Unknown command: '%s'\n", args[0])
@@ -371,7 +692,7 @@ func main() {
 func help(args []string) {
 	if len(args) == 1 {
 		fmt.Println("Usage: pmm-admin [options] <command> [command args]\n\n" +
-			"Commands: add, list, remove, server\n\n" +
+			"Commands: add, apply, backup, check, context, k8s-controller, list, metrics-server, migrate, remove, restore, server, services, watch\n\n" +
 			"  <> = required\n" +
 			"  [] = optional\n" +
 			"  [options] (-user, -password, etc.) must precede the <command>\n\n" +
@@ -389,13 +710,16 @@ func help(args []string) {
 		case "add":
 			fmt.Printf("Usage: pmm-admin [options] add <instance type> [address]\n\n" +
 				"Instance types:\n" +
-				"  os      Add local OS instance and start monitoring\n" +
-				"  mysql   Add local MySQL instance and start monitoring\n" +
-				"  mongodb Add local MongoDB instance and start monitoring\n\n" +
+				"  os         Add local OS instance and start monitoring\n" +
+				"  mysql      Add local MySQL instance and start monitoring\n" +
+				"  mongodb    Add local MongoDB instance and start monitoring\n" +
+				"  postgresql Add local PostgreSQL instance and start monitoring\n" +
+				"  proxysql   Add local ProxySQL instance and start monitoring\n\n" +
 				"When adding an OS instance (this server), specify its [address].\n\n" +
 				"When adding a MySQL instance, specify -agent-user and -agent-password" +
 				" to use an existing MySQL user. Else, the agent MySQL user will be created" +
-				" automatically.\n")
+				" automatically. Use -pg-user/-pg-host/-pg-port/-pg-sslmode for PostgreSQL" +
+				" and -proxysql-user/-proxysql-host/-proxysql-port for ProxySQL.\n")
 		case "remove":
 			fmt.Printf("Usage: pmm-admin [options] remove <instance type> <name>\n\n" +
 				"Instance types:\n" +
@@ -404,19 +728,182 @@ func help(args []string) {
 				"  mongodb Stop monitoring local MongoDB instance\n\n" +
 				"Run 'pmm-admin list' to see the name of instances being monitored.\n")
 		case "list":
-			fmt.Printf("Usage: pmm-admin list\n\nList OS, MySQL or MongoDB instances being monitored.\n")
+			fmt.Printf("Usage: pmm-admin list\n\nList OS, MySQL or MongoDB instances being monitored," +
+				" plus any backup schedules added with 'pmm-admin backup add'." +
+				" The CHECK column is the worst Consul health check status for that service.\n")
+		case "backup":
+			backupUsage()
+		case "context":
+			contextUsage()
+		case "migrate":
+			migrateUsage()
+		case "watch":
+			watchUsage()
+		case "services":
+			servicesUsage()
+		case "restore":
+			restoreUsage()
+		case "metrics-server":
+			metricsServerUsage()
+		case "check":
+			fmt.Printf("Usage: pmm-admin check\n\n" +
+				"List services whose Consul health check is not 'passing'. Use" +
+				" -check-interval/-check-timeout/-check-deregister-after with 'server' to" +
+				" change the checks registered for every instance added afterward.\n")
+		case "apply":
+			fmt.Printf("Usage: pmm-admin [options] apply -f <manifest.yaml>\n\n" +
+				"Reconciles the current PMM inventory against a YAML manifest listing" +
+				" 'server', 'os', and any number of 'mysql'/'mongodb'/'postgresql'/'proxysql'" +
+				" entries, instead of one 'pmm-admin add' per instance. Missing entries are" +
+				" added; a mongodb entry whose replset/cluster has drifted is removed and" +
+				" re-added to match. mysql/postgresql/proxysql entries already present are" +
+				" left alone even if their connection details changed - remove them (by hand," +
+				" or with -prune) and re-apply to pick that up.\n\n" +
+				"Use -dry-run to print the plan without changing anything, and -prune to" +
+				" also remove instances that exist but are not listed in the manifest.\n")
+		case "k8s-controller":
+			fmt.Printf("Usage: pmm-admin [options] k8s-controller\n\n" +
+				"Runs as a long-lived pod inside a Kubernetes cluster, watching pods" +
+				" annotated 'pmm.percona.com/monitor=mysql|mongodb|linux' and registering" +
+				" each ready one with Consul, using the pod's own IP and name. Deregisters" +
+				" on NotReady/Delete. Intended to run with multiple replicas; only the" +
+				" leader (see -k8s-lease-name) registers at a time.\n\n" +
+				"Monitored pods must run their own exporter sidecar; this command only" +
+				" manages Consul registration, not exporter processes or QAN.\n\n" +
+				"Use -k8s-namespace to restrict watching to one namespace (default: all).\n")
 		case "server":
-			fmt.Printf("Usage: pmm-admin server [address[:port]]\n\n" +
-				"Prints the address of the PMM server, or sets it if [address] given.\n")
+			fmt.Printf("Usage: pmm-admin [options] server [address[:port]]\n\n" +
+				"Prints the address of the PMM server, or sets it if [address] given.\n\n" +
+				"Use -server-insecure-tls, -server-ca, and -server-token to configure" +
+				" HTTPS and authentication against the PMM server; these are saved" +
+				" in the config file and used by every later command.\n\n" +
+				"Use -consul-token, -consul-insecure-tls, -consul-ca, -consul-client-cert," +
+				" and -consul-client-key to configure a secured Consul cluster, separately" +
+				" from the PMM server auth above. Any left unset falls back to the" +
+				" matching $CONSUL_HTTP_TOKEN/$CONSUL_CACERT/$CONSUL_CLIENT_CERT/" +
+				"$CONSUL_CLIENT_KEY/$CONSUL_HTTP_SSL_VERIFY environment variable on" +
+				" every command, the same way the consul CLI itself does.\n\n" +
+				"Use -check-interval, -check-timeout, and -check-deregister-after to" +
+				" configure the Consul health checks registered for every instance" +
+				" added afterward; see 'pmm-admin help check'.\n\n" +
+				"Use -otlp-endpoint and -otlp-sample-rate to send OpenTelemetry traces" +
+				" of every API request (Consul and the PMM server) to a collector," +
+				" for every command run afterward; see 'pmm-admin help metrics-server'" +
+				" for this client's own request metrics.\n\n" +
+				"'server' always applies to the current context; see 'pmm-admin help context'" +
+				" for managing multiple PMM servers.\n")
 		default:
 			fmt.Printf("Unknown comand: %s\n", cmd)
 		}
 	}
 }
 
-func hostConflictError(what, serverAddr string) {
-	fmt.Printf("Cannot add %s because a host with the same name but a different address already exists."+
+func instanceTags(in pmm.InstanceStatus) []string {
+	var tags []string
+	if data, ok := in.Tags.([]interface{}); ok {
+		for _, tag := range data {
+			tags = append(tags, tag.(string))
+		}
+	}
+	return tags
+}
+
+// printResult marshals v (always non-nil for format != output.Text) to
+// stdout. Text mode has its own per-command layout and never calls this.
+func printResult(format output.Format, v interface{}) {
+	s, err := output.Marshal(format, v)
+	if err != nil {
+		emitError(format, fmt.Sprintf("Error formatting output: %s\n", err), err)
+	}
+	fmt.Print(s)
+}
+
+// printAdded prints the result of a successful "add", in text or
+// output.AddResult form depending on format.
+func printAdded(format output.Format, instanceType, name, maskedDSN string, start bool, info map[string]string) {
+	if format != output.Text {
+		status := "added"
+		if start {
+			status = "monitoring"
+		}
+		printResult(format, output.AddResult{
+			Status:      status,
+			Type:        instanceType,
+			Name:        name,
+			DSNMasked:   maskedDSN,
+			QuerySource: flagQuerySource,
+			Info:        info,
+		})
+		return
+	}
+	switch instanceType {
+	case "os":
+		if start {
+			fmt.Printf("OK, now monitoring this OS as %s\n", name)
+		} else {
+			fmt.Printf("OK, added this OS as %s\n", name)
+		}
+	case "mongodb":
+		if start {
+			fmt.Printf("OK, now monitoring MongoDB %s\n", name)
+		} else {
+			fmt.Printf("OK, added MongoDB %s\n", name)
+		}
+	default:
+		if start {
+			fmt.Printf("OK, now monitoring %s %s using DSN %s\n", instanceType, name, maskedDSN)
+		} else {
+			fmt.Printf("OK, added %s %s using DSN %s\n", instanceType, name, maskedDSN)
+		}
+	}
+}
+
+// printRemoved prints the result of a successful "remove". textMsg is the
+// full text-mode message (it varies more than printAdded's, since "os"
+// doesn't even include the name).
+func printRemoved(format output.Format, instanceType, name, textMsg string) {
+	if format != output.Text {
+		printResult(format, output.RemoveResult{Status: "removed", Type: instanceType, Name: name})
+		return
+	}
+	fmt.Printf("OK, %s\n", textMsg)
+}
+
+// addError reports an "add" failure and exits: as plain text in Text mode,
+// or as output.ErrorResult on stderr with output.ExitError otherwise.
+func addError(format output.Format, instanceType string, err error) {
+	if err == pmm.ErrHostConflict {
+		emitError(format, hostConflictMsg(instanceType), err)
+		return
+	}
+	emitError(format, fmt.Sprintf("Error adding %s: %s\n", instanceType, err), err)
+}
+
+func removeError(format output.Format, instanceType, name string, err error) {
+	emitError(format, fmt.Sprintf("Error removing %s %s: %s\n", instanceType, name, err), err)
+}
+
+func hostConflictMsg(what string) string {
+	return fmt.Sprintf("Cannot add %s because a host with the same name but a different address already exists."+
 		" This can happen if two clients have the same hostname but different addresses."+
 		" To see which %s hosts already exist, run:\n\tpmm-admin list\n",
 		what, what)
 }
+
+// emitError reports a fatal command error and exits. In Text mode it prints
+// humanMsg (the existing, more detailed per-command message) and exits 1.
+// Otherwise it prints an output.ErrorResult to stderr and exits
+// output.ExitError, distinct from the 10 reserved for flag errors.
+func emitError(format output.Format, humanMsg string, err error) {
+	if format == output.Text {
+		fmt.Print(humanMsg)
+		os.Exit(1)
+	}
+	s, merr := output.Marshal(format, output.ErrorResult{Error: err.Error(), Code: output.ExitError})
+	if merr != nil {
+		fmt.Fprint(os.Stderr, humanMsg)
+		os.Exit(1)
+	}
+	fmt.Fprint(os.Stderr, s)
+	os.Exit(output.ExitError)
+}
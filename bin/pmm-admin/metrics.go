@@ -0,0 +1,73 @@
+/*
+	Copyright (c) 2016, Percona LLC and/or its affiliates. All rights reserved.
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	pmm "github.com/percona/pmm-admin"
+)
+
+// handleMetricsServer runs "pmm-admin metrics-server", serving this
+// process's pmm_admin_api_* counters/histograms (see pmm.MetricsHandler)
+// until interrupted. Like 'watch', it's a long-running daemon rather
+// than a one-shot inventory change; unlike 'watch' it doesn't need a
+// node/server address, only -otlp-endpoint/-otlp-sample-rate and
+// -metrics-addr, since it reports on this client's own requests rather
+// than Consul's state.
+func handleMetricsServer() {
+	shutdown, err := pmm.InitTelemetry(pmm.TelemetryOptions{OTLPEndpoint: flagOTLPEndpoint, SampleRate: flagOTLPSampleRate})
+	if err != nil {
+		fmt.Printf("Error starting telemetry: %s\n", err)
+		os.Exit(1)
+	}
+
+	srv := &http.Server{Addr: flagMetricsAddr, Handler: pmm.MetricsHandler()}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		srv.Close()
+	}()
+
+	fmt.Printf("Serving metrics on %s\n", flagMetricsAddr)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		fmt.Printf("Error serving metrics: %s\n", err)
+	}
+	if shutdown != nil {
+		shutdown(context.Background())
+	}
+}
+
+// metricsServerUsage is printed by 'pmm-admin help metrics-server'.
+func metricsServerUsage() {
+	fmt.Printf("Usage: pmm-admin [options] metrics-server\n\n" +
+		"Serves Prometheus metrics on -metrics-addr (default :42002) counting" +
+		" this process's own API requests: pmm_admin_api_requests_total," +
+		" pmm_admin_api_request_duration_seconds, and pmm_admin_api_retries_total," +
+		" each labeled by backend (consul/server) and method. Runs until" +
+		" interrupted with Ctrl-C.\n\n" +
+		"Use -otlp-endpoint and -otlp-sample-rate to also send per-request" +
+		" traces to an OTLP collector; see 'pmm-admin help server'.\n")
+}
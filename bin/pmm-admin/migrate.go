@@ -0,0 +1,68 @@
+/*
+	Copyright (c) 2016, Percona LLC and/or its affiliates. All rights reserved.
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/percona/pmm-admin/output"
+)
+
+// handleMigrate runs "pmm-admin migrate".
+func handleMigrate(format output.Format) {
+	report, err := admin.Migrate()
+	if err != nil {
+		emitError(format, fmt.Sprintf("Error migrating: %s\n", err), err)
+	}
+
+	if format != output.Text {
+		printResult(format, report)
+		if len(report.Failed) > 0 {
+			os.Exit(output.ExitError)
+		}
+		return
+	}
+
+	for _, s := range report.Adopted {
+		fmt.Printf("OK, %s\n", s)
+	}
+	for _, s := range report.Skipped {
+		fmt.Printf("Skipped: %s\n", s)
+	}
+	for _, s := range report.Failed {
+		fmt.Printf("Failed: %s\n", s)
+	}
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+// migrateUsage is printed by 'pmm-admin help migrate'.
+func migrateUsage() {
+	fmt.Printf("Usage: pmm-admin migrate\n\n" +
+		"Finds a standalone percona-agent or pt-agent install on this host," +
+		" stops it, backs up its config directory to '<dir>.bak', and" +
+		" re-registers what it was monitoring (this OS and any MySQL" +
+		" instances, with their QAN settings) against the current context's" +
+		" server. A pre-context pmm.yml is migrated automatically on load" +
+		" and reported here too.\n\n" +
+		"If a legacy agent already has a matching Consul registration," +
+		" it's adopted instead of re-added, so running 'migrate' again" +
+		" after a partial failure is safe.\n")
+}
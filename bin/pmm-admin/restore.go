@@ -0,0 +1,78 @@
+/*
+	Copyright (c) 2016, Percona LLC and/or its affiliates. All rights reserved.
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/percona/pmm-admin/output"
+)
+
+// handleRestore runs "pmm-admin restore <file>", replaying a manifest
+// produced by 'pmm-admin backup export'.
+func handleRestore(format output.Format, args []string) {
+	if len(args) != 2 {
+		fmt.Println("Usage: pmm-admin restore <file> (with -storage-endpoint, an S3 object key instead of a file)")
+		os.Exit(1)
+	}
+	src := args[1]
+
+	data, err := readManifest(src)
+	if err != nil {
+		emitError(format, fmt.Sprintf("Error reading %s: %s\n", src, err), err)
+	}
+	report, err := admin.Import(bytes.NewReader(data))
+	if err != nil {
+		emitError(format, fmt.Sprintf("Error restoring from %s: %s\n", src, err), err)
+	}
+
+	if format != output.Text {
+		printResult(format, report)
+		if len(report.Failed) > 0 {
+			os.Exit(output.ExitError)
+		}
+		return
+	}
+	for _, s := range report.Restored {
+		fmt.Printf("OK, restored %s\n", s)
+	}
+	for _, s := range report.Unchanged {
+		fmt.Printf("Unchanged: %s\n", s)
+	}
+	for _, s := range report.Failed {
+		fmt.Printf("Failed: %s\n", s)
+	}
+	if len(report.Failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+// restoreUsage is printed by 'pmm-admin help restore'.
+func restoreUsage() {
+	fmt.Printf("Usage: pmm-admin restore <file>\n\n" +
+		"Replays a manifest produced by 'pmm-admin backup export': registers" +
+		" any Consul service that's missing or has drifted (tags/port changed)" +
+		" from the manifest, and adds any backup schedule not already present" +
+		" by name. Entries that already match are left untouched, so restoring" +
+		" against a server whose state was never actually lost is a no-op.\n\n" +
+		"Use -storage-endpoint, -access-key, -secret-key, and -bucket to read" +
+		" <file> as an object from an S3-compatible bucket instead of a local" +
+		" file (-use-ssl for HTTPS).\n")
+}
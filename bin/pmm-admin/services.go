@@ -0,0 +1,154 @@
+/*
+	Copyright (c) 2016, Percona LLC and/or its affiliates. All rights reserved.
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	pmm "github.com/percona/pmm-admin"
+	"github.com/percona/pmm-admin/output"
+)
+
+// servicesJobs splits -job "mysql,linux" into a job list, or nil for
+// "every job" if -job wasn't given.
+func servicesJobs() []string {
+	if flagServicesJob == "" {
+		return nil
+	}
+	return strings.Split(flagServicesJob, ",")
+}
+
+// handleServices dispatches "pmm-admin services <ls|cp|rm> ...".
+func handleServices(format output.Format, args []string) {
+	if len(args) < 2 {
+		fmt.Println("Usage: pmm-admin services <ls|cp|rm> ... See 'pmm-admin help services'.")
+		os.Exit(1)
+	}
+
+	switch args[1] {
+	case "ls", "list":
+		matrix, err := admin.ListServices(flagServicesNode, flagServicesConcurrency)
+		if err != nil {
+			emitError(format, fmt.Sprintf("Error listing services: %s\n", err), err)
+		}
+		if format != output.Text {
+			printResult(format, matrix)
+			return
+		}
+		printServicesMatrix(matrix)
+
+	case "cp", "copy":
+		if len(args) != 4 {
+			fmt.Println("Usage: pmm-admin services cp <src node> <dst node> [-job job1,job2]")
+			os.Exit(1)
+		}
+		srcNode, dstNode := args[2], args[3]
+		copied, err := admin.CopyServices(srcNode, dstNode, servicesJobs(), flagDryRun)
+		if err != nil {
+			emitError(format, fmt.Sprintf("Error copying services from %s to %s: %s\n", srcNode, dstNode, err), err)
+		}
+		if format != output.Text {
+			printResult(format, copied)
+			return
+		}
+		printServicesChanged(flagDryRun, "copy to "+dstNode, copied)
+
+	case "rm", "remove":
+		if len(args) != 3 {
+			fmt.Println("Usage: pmm-admin services rm <node> [-job job1,job2]")
+			os.Exit(1)
+		}
+		node := args[2]
+		removed, err := admin.RemoveServices(node, servicesJobs(), flagDryRun)
+		if err != nil {
+			emitError(format, fmt.Sprintf("Error removing services from %s: %s\n", node, err), err)
+		}
+		if format != output.Text {
+			printResult(format, removed)
+			return
+		}
+		printServicesChanged(flagDryRun, "remove from "+node, removed)
+
+	default:
+		fmt.Printf("Unknown 'services' subcommand: %s\n", strings.Join(args[1:], " "))
+		os.Exit(1)
+	}
+}
+
+// printServicesMatrix prints 'services ls' as a nodes x jobs table.
+func printServicesMatrix(matrix map[string]map[string]pmm.ConsulService) {
+	if len(matrix) == 0 {
+		fmt.Println("No nodes found.")
+		return
+	}
+	var nodes []string
+	for node := range matrix {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	linefmt := "%-30s %s\n"
+	fmt.Printf(linefmt, "NODE", "JOBS")
+	for _, node := range nodes {
+		var jobs []string
+		for job := range matrix[node] {
+			jobs = append(jobs, job)
+		}
+		sort.Strings(jobs)
+		if len(jobs) == 0 {
+			fmt.Printf(linefmt, node, "-")
+			continue
+		}
+		fmt.Printf(linefmt, node, strings.Join(jobs, ", "))
+	}
+}
+
+// printServicesChanged prints the result of 'services cp'/'services rm':
+// the jobs affected (or, with dryRun, that would be).
+func printServicesChanged(dryRun bool, action string, jobs []string) {
+	if len(jobs) == 0 {
+		fmt.Println("No matching jobs found.")
+		return
+	}
+	verb := "OK, would"
+	if !dryRun {
+		verb = "OK,"
+	}
+	fmt.Printf("%s %s: %s\n", verb, action, strings.Join(jobs, ", "))
+}
+
+// servicesUsage is printed by 'pmm-admin help services'.
+func servicesUsage() {
+	fmt.Printf("Usage: pmm-admin services <ls|cp|rm> ...\n\n" +
+		"  services ls [-node <glob>]\n" +
+		"      List every node (optionally filtered by a glob, e.g. 'db-*') and\n" +
+		"      the jobs registered on each. Queries up to -services-concurrency\n" +
+		"      nodes at once.\n" +
+		"  services cp <src node> <dst node> [-job job1,job2]\n" +
+		"      Re-register src node's services (or only the listed jobs) on dst\n" +
+		"      node, using dst node's own registered address. The health check is\n" +
+		"      re-created fresh, since Consul's catalog doesn't expose the\n" +
+		"      original check definition to copy.\n" +
+		"  services rm <node> [-job job1,job2]\n" +
+		"      Deregister node's services (or only the listed jobs) in bulk.\n\n" +
+		"'cp' and 'rm' honor -dry-run, printing what would change without" +
+		" changing anything.\n")
+}
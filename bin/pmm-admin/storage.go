@@ -0,0 +1,75 @@
+/*
+	Copyright (c) 2016, Percona LLC and/or its affiliates. All rights reserved.
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	minio "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// writeManifest writes data to name: a local file, or (if
+// -storage-endpoint is set) an object named name in the configured
+// S3-compatible bucket. Used by 'pmm-admin backup export'.
+func writeManifest(name string, data []byte) error {
+	if flagStorageEndpoint == "" {
+		return ioutil.WriteFile(name, data, 0644)
+	}
+	client, err := storageClient()
+	if err != nil {
+		return err
+	}
+	_, err = client.PutObject(context.Background(), flagBucket, name, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/json"})
+	return err
+}
+
+// readManifest reads name: a local file, or (if -storage-endpoint is
+// set) an object named name in the configured S3-compatible bucket.
+// Used by 'pmm-admin restore'.
+func readManifest(name string) ([]byte, error) {
+	if flagStorageEndpoint == "" {
+		return ioutil.ReadFile(name)
+	}
+	client, err := storageClient()
+	if err != nil {
+		return nil, err
+	}
+	obj, err := client.GetObject(context.Background(), flagBucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return ioutil.ReadAll(obj)
+}
+
+// storageClient builds an S3-compatible client (works against MinIO and
+// AWS S3 alike) from -storage-endpoint/-access-key/-secret-key/-use-ssl.
+func storageClient() (*minio.Client, error) {
+	if flagBucket == "" {
+		return nil, fmt.Errorf("-bucket is required with -storage-endpoint")
+	}
+	return minio.New(flagStorageEndpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(flagAccessKey, flagSecretKey, ""),
+		Secure: flagUseSSL,
+	})
+}
@@ -0,0 +1,76 @@
+/*
+	Copyright (c) 2016, Percona LLC and/or its affiliates. All rights reserved.
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	pmm "github.com/percona/pmm-admin"
+)
+
+// handleWatch runs "pmm-admin watch", printing a live table of this
+// host's Consul service add/remove/health-change events until
+// interrupted.
+func handleWatch() {
+	node, err := admin.OS()
+	if err != nil {
+		fmt.Printf("Error getting this host's OS instance: %s\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	events, err := admin.WatchServices(ctx, node.Name)
+	if err != nil {
+		fmt.Printf("Error watching %s: %s\n", node.Name, err)
+		os.Exit(1)
+	}
+
+	linefmt := "%-20s %-10s %-20s %s\n"
+	fmt.Printf(linefmt, "TIME", "EVENT", "SERVICE", "STATUS")
+	for event := range events {
+		status := event.Status
+		if status == "" {
+			status = "n/a"
+		}
+		fmt.Printf(linefmt, time.Now().Format("15:04:05"), event.Type, event.Service, status)
+	}
+}
+
+// watchUsage is printed by 'pmm-admin help watch'.
+func watchUsage() {
+	fmt.Printf("Usage: pmm-admin watch\n\n" +
+		"Prints a live table of this host's Consul service registrations" +
+		" as they change: added, removed, or a health check status change." +
+		" Uses Consul blocking queries, so it reacts immediately instead of" +
+		" polling, and backs off automatically if Consul is unreachable." +
+		" Runs until interrupted with Ctrl-C.\n\n" +
+		"Useful for noticing drift, e.g. a service manually removed from" +
+		" Consul outside of 'pmm-admin remove'.\n")
+}
@@ -18,8 +18,12 @@
 package pmm
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/percona/go-mysql/dsn"
@@ -136,6 +140,50 @@ func (m *MySQLConn) createAgentMySQLUser(userDSN dsn.DSN) (dsn.DSN, error) {
 	return agentDSN, nil
 }
 
+// AgentInitFile renders the grant statements that would normally be run
+// directly against MySQL (via createAgentMySQLUser) into a SQL file instead,
+// for MySQL installs (containers, Kubernetes-managed instances) where the
+// only way to provision a user is an init-file applied at MySQL startup.
+// It never opens a connection: the returned agentDSN uses a freshly
+// generated password that only takes effect once the operator copies the
+// file into MySQL's init-file and restarts the server.
+func (m *MySQLConn) AgentInitFile(path string) (dsn.DSN, error) {
+	password, err := randomPassword(20)
+	if err != nil {
+		return dsn.DSN{}, err
+	}
+
+	agentDSN := m.userDSN
+	agentDSN.Username = DEFAULT_MYSQL_USER
+	agentDSN.Password = password
+
+	// MakeGrant already includes the "SET SESSION old_passwords=0" prelude.
+	statements := MakeGrant(agentDSN, m.maxUserConn)
+
+	// Same as createAgentMySQLUser: also grant @127.0.0.1 because the Go
+	// MySQL driver resolves "localhost" to "127.0.0.1".
+	if agentDSN.Hostname == "localhost" {
+		agentDSN127 := agentDSN
+		agentDSN127.Hostname = "127.0.0.1"
+		statements = append(statements, MakeGrant(agentDSN127, m.maxUserConn)...)
+	}
+
+	sql := strings.Join(statements, ";\n") + ";\n"
+	if err := ioutil.WriteFile(path, []byte(sql), 0600); err != nil {
+		return dsn.DSN{}, fmt.Errorf("cannot write init-file %s: %s", path, err)
+	}
+
+	return agentDSN, nil
+}
+
+func randomPassword(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 func (m *MySQLConn) TestConnection(newDSN dsn.DSN) error {
 	var err error
 	var db *sql.DB
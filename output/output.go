@@ -0,0 +1,115 @@
+/*
+   Copyright (c) 2016, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+// Package output renders pmm-admin command results as JSON or YAML, so the
+// CLI can be driven by Ansible/Terraform wrappers instead of only humans
+// reading the default text format.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Format is a supported -format value.
+type Format string
+
+const (
+	Text Format = "text"
+	JSON Format = "json"
+	YAML Format = "yaml"
+)
+
+// ExitError is the process exit code for a failed command when -format is
+// json or yaml. It is distinct from 10, which install.sh depends on and is
+// reserved for flag-parsing errors (see main.go).
+const ExitError = 20
+
+// ParseFormat validates a -format flag value, defaulting "" to Text.
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "":
+		return Text, nil
+	case Text, JSON, YAML:
+		return Format(s), nil
+	default:
+		return "", fmt.Errorf("invalid -format '%s', expected text, json, or yaml", s)
+	}
+}
+
+// ListItem is one row of "pmm-admin list" in machine-readable output.
+type ListItem struct {
+	Type        string   `json:"type" yaml:"type"`
+	Name        string   `json:"name" yaml:"name"`
+	Address     string   `json:"address,omitempty" yaml:"address,omitempty"`
+	DSNMasked   string   `json:"dsn_masked,omitempty" yaml:"dsn_masked,omitempty"`
+	Tags        []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	CheckStatus string   `json:"check_status,omitempty" yaml:"check_status,omitempty"`
+}
+
+// AddResult is the result of "pmm-admin add <type>" in machine-readable output.
+type AddResult struct {
+	Status      string            `json:"status" yaml:"status"`
+	Type        string            `json:"type" yaml:"type"`
+	Name        string            `json:"name" yaml:"name"`
+	DSNMasked   string            `json:"dsn_masked,omitempty" yaml:"dsn_masked,omitempty"`
+	QuerySource string            `json:"query_source,omitempty" yaml:"query_source,omitempty"`
+	Info        map[string]string `json:"info,omitempty" yaml:"info,omitempty"`
+}
+
+// RemoveResult is the result of "pmm-admin remove <type>" in machine-readable output.
+type RemoveResult struct {
+	Status string `json:"status" yaml:"status"`
+	Type   string `json:"type" yaml:"type"`
+	Name   string `json:"name" yaml:"name"`
+}
+
+// CheckResult is one failing entry of "pmm-admin check" in machine-readable output.
+type CheckResult struct {
+	Service string `json:"service" yaml:"service"`
+	Status  string `json:"status" yaml:"status"`
+}
+
+// ErrorResult is printed to stderr on failure when -format is json or yaml.
+type ErrorResult struct {
+	Error string `json:"error" yaml:"error"`
+	Code  int    `json:"code" yaml:"code"`
+}
+
+// Marshal renders v as JSON or YAML. Format must be JSON or YAML; callers
+// keep using fmt.Printf directly for Text, which has its own, more detailed
+// per-command layout.
+func Marshal(format Format, v interface{}) (string, error) {
+	switch format {
+	case JSON:
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(b) + "\n", nil
+	case YAML:
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	default:
+		return "", fmt.Errorf("unsupported format: %s", format)
+	}
+}
@@ -0,0 +1,287 @@
+/*
+	Copyright (c) 2016, Percona LLC and/or its affiliates. All rights reserved.
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+// Package k8s watches a Kubernetes cluster's pods and keeps Consul's
+// catalog in sync with their lifecycle, the same way kube2consul and the
+// consul-k8s endpoints controller do for plain Consul services.
+//
+// Pods opt in with a "pmm.percona.com/monitor" annotation naming what
+// they are ("mysql", "mongodb", or "linux"). Controller registers one
+// Consul service per ready pod (pmm.Admin.RegisterService, with the pod's
+// IP as the check/service address and the pod's name as the Consul node)
+// and deregisters it on NotReady/Delete.
+//
+// It deliberately does not reuse the full 'pmm-admin add mysql'/'add
+// mongodb' flow: AddMySQL/AddMongoDB also start a local mysqld_exporter
+// and tell QAN which locally-running percona-qan-agent collects its
+// queries, and there is no locally-running agent for a pod this process
+// doesn't own. A pod monitored this way is expected to run its own
+// exporter sidecar and report queries on its own, the same assumption
+// kube2consul makes for service registration; only the Consul
+// registration (and its HTTP health check) is handled centrally.
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pmm "github.com/percona/pmm-admin"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// MonitorAnnotation selects which pods Controller registers with PMM,
+// and as what: "mysql", "mongodb", or "linux".
+const MonitorAnnotation = "pmm.percona.com/monitor"
+
+// sourceTag marks every Consul service Controller registers, so reconcile
+// can tell its own registrations apart from services added some other
+// way (e.g. 'pmm-admin add' on a regular host).
+const sourceTag = "source=k8s"
+
+// jobPorts maps a MonitorAnnotation value to the port its exporter
+// sidecar is expected to serve /metrics on, mirroring the ports AddOS/
+// AddMySQL/AddMongoDB use for locally-started exporters.
+var jobPorts = map[string]uint16{
+	"linux":   9100,
+	"mysql":   9104,
+	"mongodb": 9107,
+}
+
+// Options configures Controller.
+type Options struct {
+	// Namespace restricts the watch to one namespace; "" watches every
+	// namespace the controller's ServiceAccount can list.
+	Namespace string
+
+	// ResyncPeriod is how often the informer replays its cache, as a
+	// backstop against missed watch events. Defaults to 30s.
+	ResyncPeriod time.Duration
+
+	// LeaseName/LeaseNamespace identify the Lease used to elect one
+	// leader among controller replicas; only the leader registers pods.
+	// Default to "pmm-admin-k8s-controller" / "default".
+	LeaseName      string
+	LeaseNamespace string
+
+	// Identity distinguishes this replica's leader-election record from
+	// the others', e.g. the pod name. Required.
+	Identity string
+}
+
+func (o Options) resolved() Options {
+	if o.ResyncPeriod == 0 {
+		o.ResyncPeriod = 30 * time.Second
+	}
+	if o.LeaseName == "" {
+		o.LeaseName = "pmm-admin-k8s-controller"
+	}
+	if o.LeaseNamespace == "" {
+		o.LeaseNamespace = "default"
+	}
+	return o
+}
+
+// Controller watches pods annotated with MonitorAnnotation and registers/
+// deregisters them with Consul via admin as they become ready, not ready,
+// or are deleted.
+type Controller struct {
+	admin  *pmm.Admin
+	client kubernetes.Interface
+	opts   Options
+
+	// registered tracks the job this controller last registered for each
+	// pod name, so a Delete event (which may arrive after the pod object
+	// has lost its annotations) still knows what to deregister.
+	registered map[string]string
+}
+
+// NewController returns a Controller that registers ready pods from admin.
+func NewController(admin *pmm.Admin, client kubernetes.Interface, opts Options) *Controller {
+	return &Controller{
+		admin:      admin,
+		client:     client,
+		opts:       opts.resolved(),
+		registered: make(map[string]string),
+	}
+}
+
+// Run participates in leader election and, for as long as this replica is
+// leader, watches pods until ctx is canceled. It blocks until ctx is done.
+func (c *Controller) Run(ctx context.Context) error {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      c.opts.LeaseName,
+			Namespace: c.opts.LeaseNamespace,
+		},
+		Client: c.client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: c.opts.Identity,
+		},
+	}
+
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				if err := c.runAsLeader(ctx); err != nil && ctx.Err() == nil {
+					fmt.Printf("k8s-controller: %s\n", err)
+				}
+			},
+			OnStoppedLeading: func() {
+				fmt.Println("k8s-controller: lost leadership, stepping down")
+			},
+		},
+	})
+	return ctx.Err()
+}
+
+func (c *Controller) runAsLeader(ctx context.Context) error {
+	if err := c.reconcile(ctx); err != nil {
+		fmt.Printf("k8s-controller: startup reconciliation: %s\n", err)
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(c.client, c.opts.ResyncPeriod,
+		informers.WithNamespace(c.opts.Namespace))
+	pods := factory.Core().V1().Pods().Informer()
+
+	pods.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.onPodUpdate(obj) },
+		UpdateFunc: func(old, new interface{}) { c.onPodUpdate(new) },
+		DeleteFunc: func(obj interface{}) { c.onPodDelete(obj) },
+	})
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), pods.HasSynced) {
+		return fmt.Errorf("timed out waiting for pod cache to sync")
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+// onPodUpdate registers pod if it's annotated and ready, or deregisters
+// it if it was previously registered but has since become not ready.
+func (c *Controller) onPodUpdate(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+
+	job, annotated := pod.Annotations[MonitorAnnotation]
+	if !annotated || !podReady(pod) {
+		c.deregister(pod.Name)
+		return
+	}
+
+	port, ok := jobPorts[job]
+	if !ok {
+		fmt.Printf("k8s-controller: pod %s has unknown %s=%s, skipping\n", pod.Name, MonitorAnnotation, job)
+		return
+	}
+
+	target := pmm.Target{Node: pod.Name, Address: pod.Status.PodIP}
+	if err := c.admin.RegisterService(target, job, port, []string{sourceTag}); err != nil {
+		fmt.Printf("k8s-controller: register %s (pod %s): %s\n", job, pod.Name, err)
+		return
+	}
+	c.registered[pod.Name] = job
+}
+
+func (c *Controller) onPodDelete(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			pod, ok = d.Obj.(*corev1.Pod)
+			if !ok {
+				return
+			}
+		} else {
+			return
+		}
+	}
+	c.deregister(pod.Name)
+}
+
+func (c *Controller) deregister(podName string) {
+	job, ok := c.registered[podName]
+	if !ok {
+		return
+	}
+	if err := c.admin.DeregisterService(pmm.Target{Node: podName}, job); err != nil {
+		fmt.Printf("k8s-controller: deregister %s (pod %s): %s\n", job, podName, err)
+		return
+	}
+	delete(c.registered, podName)
+}
+
+// reconcile removes registrations left over from a previous controller
+// process (e.g. a replica that missed Delete events while not leader, or
+// crashed) whose pod no longer exists.
+func (c *Controller) reconcile(ctx context.Context) error {
+	pods, err := c.client.CoreV1().Pods(c.opts.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	live := make(map[string]bool, len(pods.Items))
+	for _, pod := range pods.Items {
+		live[pod.Name] = true
+		if job, ok := pod.Annotations[MonitorAnnotation]; ok && podReady(&pod) {
+			c.registered[pod.Name] = job
+		}
+	}
+
+	for job := range jobPorts {
+		nodes, err := c.admin.NodesByService(job, sourceTag)
+		if err != nil {
+			return fmt.Errorf("listing %s nodes: %s", job, err)
+		}
+		for _, node := range nodes {
+			if live[node] {
+				continue
+			}
+			if err := c.admin.DeregisterService(pmm.Target{Node: node}, job); err != nil {
+				fmt.Printf("k8s-controller: reconcile: deregister stale %s (node %s): %s\n", job, node, err)
+				continue
+			}
+		}
+	}
+	return nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	if pod.Status.PodIP == "" || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
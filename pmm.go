@@ -18,13 +18,22 @@
 package pmm
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
-
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/percona/go-mysql/dsn"
 	"github.com/percona/pmm/proto"
 	"gopkg.in/yaml.v2"
 )
@@ -40,16 +49,106 @@ var (
 	ErrHostConflict = errors.New("host conflict")
 )
 
+// Config is the pmm.yml file: every PMM server this installation knows
+// about (Contexts), and which one commands use by default
+// (CurrentContext). '-context <name>' overrides CurrentContext for a
+// single command, the same way kubectl's --context does, so one
+// pmm-admin install can be pointed at several PMM servers (e.g. staging
+// and prod) without hand-editing the config file.
 type Config struct {
+	Contexts       map[string]*ServerContext `yaml:"contexts"`
+	CurrentContext string                    `yaml:"current_context"`
+}
+
+// DefaultContext is the name LoadConfig migrates a pre-context config
+// file's single server into, and the one 'pmm-admin server'/'add os'
+// bootstrap when no context has been selected yet.
+const DefaultContext = "default"
+
+// ServerContext is everything pmm-admin needs to talk to one PMM server
+// and manage this host's instances on it: the server address, this
+// host's own client address/UUID, and that server's TLS/auth and Consul
+// health check settings.
+type ServerContext struct {
+	ServerAddress string `yaml:"server_address"`
 	ClientAddress string `yaml:"client_address"`
 	ClientUUID    string `yaml:"client_uuid"`
-	ServerAddress string `yaml:"server_address"`
+
+	// Server TLS/auth, set via 'pmm-admin server --server-insecure-tls
+	// --server-ca --server-token' and picked up by every later command.
+	ServerInsecureTLS bool   `yaml:"server_insecure_tls,omitempty"`
+	ServerCAFile      string `yaml:"server_ca_file,omitempty"`
+	ServerToken       string `yaml:"server_token,omitempty"`
+
+	// Consul health check settings, set via 'pmm-admin server
+	// --check-interval --check-timeout --check-deregister-after' and
+	// applied to every service registered afterward. Empty means use the
+	// Default* constants.
+	CheckInterval                string `yaml:"check_interval,omitempty"`
+	CheckTimeout                 string `yaml:"check_timeout,omitempty"`
+	CheckDeregisterCriticalAfter string `yaml:"check_deregister_critical_after,omitempty"`
+
+	// Consul ACL/TLS, set via 'pmm-admin server --consul-token
+	// --consul-ca --consul-cert --consul-key --consul-insecure-tls' and
+	// sent on every catalog/health/KV request instead of the PMM
+	// server's own auth (ServerToken etc above), since Consul is
+	// typically a separate, independently secured cluster. Each also
+	// falls back to the matching CONSUL_* environment variable (see
+	// consulAPI) when left unset, mirroring the Consul CLI.
+	ConsulToken       string `yaml:"consul_token,omitempty"`
+	ConsulInsecureTLS bool   `yaml:"consul_insecure_tls,omitempty"`
+	ConsulCAFile      string `yaml:"consul_ca_file,omitempty"`
+	ConsulCertFile    string `yaml:"consul_cert_file,omitempty"`
+	ConsulKeyFile     string `yaml:"consul_key_file,omitempty"`
+
+	// OpenTelemetry tracing for every API request, set via 'pmm-admin
+	// server -otlp-endpoint -otlp-sample-rate' and picked up once at
+	// startup by InitTelemetry (see Admin.TelemetryOptions). Empty
+	// OTLPEndpoint leaves tracing off.
+	TelemetryOTLPEndpoint string  `yaml:"telemetry_otlp_endpoint,omitempty"`
+	TelemetrySampleRate   float64 `yaml:"telemetry_sample_rate,omitempty"`
+}
+
+// legacyConfig is the pre-context pmm.yml format: one flat ServerContext
+// instead of a Contexts map. LoadConfig migrates it into
+// Contexts[DefaultContext] the first time it reads an old config file.
+type legacyConfig struct {
+	ClientAddress                string `yaml:"client_address"`
+	ClientUUID                   string `yaml:"client_uuid"`
+	ServerAddress                string `yaml:"server_address"`
+	ServerInsecureTLS            bool   `yaml:"server_insecure_tls,omitempty"`
+	ServerCAFile                 string `yaml:"server_ca_file,omitempty"`
+	ServerToken                  string `yaml:"server_token,omitempty"`
+	CheckInterval                string `yaml:"check_interval,omitempty"`
+	CheckTimeout                 string `yaml:"check_timeout,omitempty"`
+	CheckDeregisterCriticalAfter string `yaml:"check_deregister_critical_after,omitempty"`
 }
 
+// Defaults applied when the corresponding Config.Check* field is empty.
+const (
+	DefaultCheckInterval                = "10s"
+	DefaultCheckTimeout                 = "5s"
+	DefaultCheckDeregisterCriticalAfter = "5m"
+)
+
 type ConsulService struct {
 	Service string
 	Port    uint16
-	Tags    []string `json:"Tags,omitempty"`
+	Tags    []string     `json:"Tags,omitempty"`
+	Check   *ConsulCheck `json:",omitempty"`
+}
+
+// ConsulCheck is an active health check Consul runs against a registered
+// service. pmm-admin only ever sets HTTP (an exporter's /metrics
+// endpoint): Consul polls it every Interval, times it out after Timeout,
+// and deregisters the service if it stays critical for
+// DeregisterCriticalServiceAfter. Without this, a dead exporter keeps
+// reporting "passing" forever and Prometheus never stops scraping it.
+type ConsulCheck struct {
+	HTTP                           string `json:",omitempty"`
+	Interval                       string `json:",omitempty"`
+	Timeout                        string `json:",omitempty"`
+	DeregisterCriticalServiceAfter string `json:",omitempty"`
 }
 
 type ConsulNode struct {
@@ -63,12 +162,53 @@ type InstanceStatus struct {
 	Type string
 	Name string
 	Tags interface{}
+
+	// CheckStatus is this service's worst Consul health check status
+	// ("passing", "warning", or "critical"), or "" if it has no checks
+	// registered (e.g. an instance added before checks existed).
+	CheckStatus string `json:",omitempty"`
+
+	// Address is this client's reporting address (a.ctx().ClientAddress at
+	// add time), the same for every instance on this node.
+	Address string `json:",omitempty"`
+
+	// DSNMasked is the instance's DSN with the password redacted, safe to
+	// print. Only populated for instance types whose DSN is retrievable
+	// after the fact (currently just mysql, via the QAN API's instance
+	// record); mongodb/postgresql/proxysql DSNs are only ever passed as
+	// exporter args and aren't persisted anywhere pmm-admin can read back.
+	DSNMasked string `json:",omitempty"`
+}
+
+// HealthCheck mirrors the subset of a Consul /v1/health/node/<node> entry
+// pmm-admin needs: which service a check belongs to, and its status.
+type HealthCheck struct {
+	CheckID     string
+	Name        string
+	Status      string
+	Notes       string
+	Output      string
+	ServiceID   string
+	ServiceName string
 }
 
 type Admin struct {
 	filename string
 	config   *Config
 	api      *API
+
+	// consul is a separate *API client for Consul catalog/health/KV
+	// requests, built lazily by consulAPI() from the current context's
+	// Consul ACL/TLS settings. It must not be api itself: api's
+	// Token/APIKey authenticate against the PMM server, and sending
+	// those to Consul (or vice versa) would be wrong whenever the two
+	// are secured independently.
+	consul *API
+
+	// legacyConfigMigrated is set by LoadConfig when filename turned out
+	// to be a pre-context pmm.yml, so Migrate() can report it alongside
+	// whatever legacy agents it also found.
+	legacyConfigMigrated bool
 }
 
 func NewAdmin() *Admin {
@@ -77,20 +217,48 @@ func NewAdmin() *Admin {
 }
 
 func (a *Admin) LoadConfig(filename string) error {
+	a.filename = filename
 	if !FileExists(filename) {
-		a.filename = filename
-		a.config = &Config{}
+		a.config = &Config{Contexts: map[string]*ServerContext{}}
 		return nil
 	}
 	bytes, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return err
 	}
+
 	config := &Config{}
 	if err := yaml.Unmarshal(bytes, config); err != nil {
 		return err
 	}
-	a.filename = filename
+	if config.Contexts == nil {
+		// Pre-context config file: it unmarshaled into none of Config's
+		// fields, so migrate its flat fields into a "default" context
+		// instead of making the user redo 'server'/'add os' by hand.
+		legacy := &legacyConfig{}
+		if err := yaml.Unmarshal(bytes, legacy); err != nil {
+			return err
+		}
+		config.Contexts = map[string]*ServerContext{
+			DefaultContext: {
+				ServerAddress:                legacy.ServerAddress,
+				ClientAddress:                legacy.ClientAddress,
+				ClientUUID:                   legacy.ClientUUID,
+				ServerInsecureTLS:            legacy.ServerInsecureTLS,
+				ServerCAFile:                 legacy.ServerCAFile,
+				ServerToken:                  legacy.ServerToken,
+				CheckInterval:                legacy.CheckInterval,
+				CheckTimeout:                 legacy.CheckTimeout,
+				CheckDeregisterCriticalAfter: legacy.CheckDeregisterCriticalAfter,
+			},
+		}
+		config.CurrentContext = DefaultContext
+		a.legacyConfigMigrated = true
+	}
+	if config.CurrentContext == "" {
+		config.CurrentContext = DefaultContext
+	}
+
 	a.config = config
 	return nil
 }
@@ -99,27 +267,373 @@ func (a *Admin) SetAPI(api *API) {
 	a.api = api
 }
 
+// UseCurrentContext overrides the context LoadConfig selected, for
+// '-context <name>'. It does not require name to already exist: like
+// CurrentContext itself, the context is created on first write (see
+// ctx()), so '-context staging add os ...' both selects and bootstraps a
+// new context in one command.
+func (a *Admin) UseCurrentContext(name string) {
+	if name == "" {
+		return
+	}
+	a.config.CurrentContext = name
+}
+
+// ctx returns the active ServerContext (Config.CurrentContext), creating
+// an empty one if this is the first time it's been touched.
+func (a *Admin) ctx() *ServerContext {
+	if a.config.Contexts == nil {
+		a.config.Contexts = map[string]*ServerContext{}
+	}
+	if a.config.CurrentContext == "" {
+		a.config.CurrentContext = DefaultContext
+	}
+	c, ok := a.config.Contexts[a.config.CurrentContext]
+	if !ok {
+		c = &ServerContext{}
+		a.config.Contexts[a.config.CurrentContext] = c
+	}
+	return c
+}
+
+// CurrentContext returns the name of the context commands are using.
+func (a *Admin) CurrentContext() string {
+	if a.config.CurrentContext == "" {
+		return DefaultContext
+	}
+	return a.config.CurrentContext
+}
+
+// UseContext switches the persisted current context to name, which must
+// already exist (see AddContext).
+func (a *Admin) UseContext(name string) error {
+	if _, ok := a.config.Contexts[name]; !ok {
+		return fmt.Errorf("no such context: %s", name)
+	}
+	a.config.CurrentContext = name
+	return a.writeConfig()
+}
+
+// AddContext creates a new context named name pointed at addr and
+// switches to it, the same way 'pmm-admin server <addr>' bootstraps the
+// default context today.
+func (a *Admin) AddContext(name, addr string) error {
+	if a.config.Contexts == nil {
+		a.config.Contexts = map[string]*ServerContext{}
+	}
+	if _, ok := a.config.Contexts[name]; ok {
+		return fmt.Errorf("context %s already exists", name)
+	}
+	a.config.Contexts[name] = &ServerContext{ServerAddress: addr}
+	a.config.CurrentContext = name
+	return a.writeConfig()
+}
+
+// RemoveContext deletes context name. It refuses to remove the current
+// context so a later command is never left without one; switch to
+// another context first.
+func (a *Admin) RemoveContext(name string) error {
+	if name == a.config.CurrentContext {
+		return fmt.Errorf("cannot remove the current context (%s); switch to another one first", name)
+	}
+	if _, ok := a.config.Contexts[name]; !ok {
+		return fmt.Errorf("no such context: %s", name)
+	}
+	delete(a.config.Contexts, name)
+	return a.writeConfig()
+}
+
+// ListContexts returns every configured context name, sorted, and the
+// name of the current one.
+func (a *Admin) ListContexts() (names []string, current string) {
+	for name := range a.config.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, a.CurrentContext()
+}
+
 func (a *Admin) Server() string {
-	return a.config.ServerAddress
+	return a.ctx().ServerAddress
 }
 
 func (a *Admin) SetServer(addr string) error {
-	a.config.ServerAddress = addr
+	a.ctx().ServerAddress = addr
+	return a.writeConfig()
+}
+
+// SetServerAuth persists the TLS/token settings used to talk to the PMM
+// server so that APIOptions() can build an authenticated client for
+// every subsequent command without the caller passing flags again.
+func (a *Admin) SetServerAuth(insecureTLS bool, caFile, token string) error {
+	a.ctx().ServerInsecureTLS = insecureTLS
+	a.ctx().ServerCAFile = caFile
+	a.ctx().ServerToken = token
+	return a.writeConfig()
+}
+
+// ServerAuth returns the currently persisted PMM server TLS/token
+// settings, so a caller re-running SetServerAuth (e.g. 'pmm-admin
+// server' or 'apply', which bootstraps auth on every invocation) can
+// merge in whichever flags were actually passed this time and leave the
+// rest as they were, instead of resetting them to the flags' defaults.
+func (a *Admin) ServerAuth() (insecureTLS bool, caFile, token string) {
+	return a.ctx().ServerInsecureTLS, a.ctx().ServerCAFile, a.ctx().ServerToken
+}
+
+// APIOptions builds the APIOptions to use for NewAPI from the persisted
+// server TLS/token config.
+func (a *Admin) APIOptions() APIOptions {
+	return APIOptions{
+		Token:              a.ctx().ServerToken,
+		CAFile:             a.ctx().ServerCAFile,
+		InsecureSkipVerify: a.ctx().ServerInsecureTLS,
+		Backend:            "server",
+	}
+}
+
+// SetCheckConfig persists the Consul health check interval, timeout, and
+// deregister-after used for every service registered from now on.
+func (a *Admin) SetCheckConfig(interval, timeout, deregisterAfter string) error {
+	a.ctx().CheckInterval = interval
+	a.ctx().CheckTimeout = timeout
+	a.ctx().CheckDeregisterCriticalAfter = deregisterAfter
+	return a.writeConfig()
+}
+
+// CheckConfig returns the currently persisted check settings, for the
+// same merge-with-flags purpose as ServerAuth.
+func (a *Admin) CheckConfig() (interval, timeout, deregisterAfter string) {
+	return a.ctx().CheckInterval, a.ctx().CheckTimeout, a.ctx().CheckDeregisterCriticalAfter
+}
+
+// SetConsulAuth persists the ACL token and TLS settings used to talk to
+// Consul, separate from SetServerAuth's PMM server settings. Any empty
+// argument leaves Consul relying on its matching CONSUL_* environment
+// variable instead (see consulAPI).
+func (a *Admin) SetConsulAuth(token string, insecureTLS bool, caFile, certFile, keyFile string) error {
+	a.ctx().ConsulToken = token
+	a.ctx().ConsulInsecureTLS = insecureTLS
+	a.ctx().ConsulCAFile = caFile
+	a.ctx().ConsulCertFile = certFile
+	a.ctx().ConsulKeyFile = keyFile
+	a.consul = nil // rebuilt by the next consulAPI() call
 	return a.writeConfig()
 }
 
+// ConsulAuth returns the currently persisted Consul ACL/TLS settings,
+// for the same merge-with-flags purpose as ServerAuth.
+func (a *Admin) ConsulAuth() (token string, insecureTLS bool, caFile, certFile, keyFile string) {
+	c := a.ctx()
+	return c.ConsulToken, c.ConsulInsecureTLS, c.ConsulCAFile, c.ConsulCertFile, c.ConsulKeyFile
+}
+
+// SetTelemetryConfig persists the OTLP endpoint/sample rate InitTelemetry
+// uses to trace every API request from now on.
+func (a *Admin) SetTelemetryConfig(otlpEndpoint string, sampleRate float64) error {
+	a.ctx().TelemetryOTLPEndpoint = otlpEndpoint
+	a.ctx().TelemetrySampleRate = sampleRate
+	return a.writeConfig()
+}
+
+// TelemetryOptions returns the current context's OTLP settings, for
+// 'pmm-admin' to pass to InitTelemetry once at startup.
+func (a *Admin) TelemetryOptions() TelemetryOptions {
+	return TelemetryOptions{
+		OTLPEndpoint: a.ctx().TelemetryOTLPEndpoint,
+		SampleRate:   a.ctx().TelemetrySampleRate,
+	}
+}
+
+// httpCheck builds the ConsulCheck every registered exporter service gets:
+// an HTTP check against its own /metrics endpoint, using the persisted
+// check config (falling back to the Default* constants).
+func (a *Admin) httpCheck(url string) *ConsulCheck {
+	interval := a.ctx().CheckInterval
+	if interval == "" {
+		interval = DefaultCheckInterval
+	}
+	timeout := a.ctx().CheckTimeout
+	if timeout == "" {
+		timeout = DefaultCheckTimeout
+	}
+	deregisterAfter := a.ctx().CheckDeregisterCriticalAfter
+	if deregisterAfter == "" {
+		deregisterAfter = DefaultCheckDeregisterCriticalAfter
+	}
+	return &ConsulCheck{
+		HTTP:                           url,
+		Interval:                       interval,
+		Timeout:                        timeout,
+		DeregisterCriticalServiceAfter: deregisterAfter,
+	}
+}
+
+// consulAPI returns the *API client for Consul catalog/health/KV
+// requests, built from the current context's Consul ACL token and TLS
+// settings, each falling back to its Consul-CLI-style environment
+// variable (CONSUL_HTTP_TOKEN, CONSUL_CACERT, CONSUL_CLIENT_CERT,
+// CONSUL_CLIENT_KEY, CONSUL_HTTP_SSL_VERIFY=false) when left unset in
+// the config file, so operators can authenticate ambiently the same way
+// the consul CLI itself does. It reuses a.api's timeout/retry policy,
+// since those aren't Consul- or PMM-server-specific, and is cached for
+// the life of the process (one context per invocation).
+func (a *Admin) consulAPI() *API {
+	if a.consul != nil {
+		return a.consul
+	}
+
+	c := a.ctx()
+	token := c.ConsulToken
+	if token == "" {
+		token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+	caFile := c.ConsulCAFile
+	if caFile == "" {
+		caFile = os.Getenv("CONSUL_CACERT")
+	}
+	certFile := c.ConsulCertFile
+	if certFile == "" {
+		certFile = os.Getenv("CONSUL_CLIENT_CERT")
+	}
+	keyFile := c.ConsulKeyFile
+	if keyFile == "" {
+		keyFile = os.Getenv("CONSUL_CLIENT_KEY")
+	}
+	insecureTLS := c.ConsulInsecureTLS
+	if !insecureTLS {
+		if v := os.Getenv("CONSUL_HTTP_SSL_VERIFY"); v == "false" || v == "0" {
+			insecureTLS = true
+		}
+	}
+
+	var headers map[string]string
+	if token != "" {
+		headers = map[string]string{"X-Consul-Token": token}
+	}
+
+	opts := APIOptions{
+		CAFile:             caFile,
+		CertFile:           certFile,
+		KeyFile:            keyFile,
+		InsecureSkipVerify: insecureTLS,
+		Backend:            "consul",
+	}
+	if a.api != nil {
+		opts.Timeout = a.api.opts.Timeout
+		opts.Retry = a.api.opts.Retry
+	}
+
+	a.consul = NewAPI(headers, opts)
+	return a.consul
+}
+
+// Target identifies one Consul node/address pair to register a service
+// against: a node name (ConsulNode.Node / ServiceID lookups) and address
+// (ConsulNode.Address and the health check URL). AddMySQL, AddMongoDB,
+// and AddOS always target this process's own host
+// (a.ctx().ClientAddress/ClientUUID), since the mysqld_exporter and
+// percona-qan-agent processes they start only run locally. RegisterService
+// and DeregisterService take an explicit Target instead, so pkg/pmm/k8s
+// can register one Consul service per pod from a single controller
+// process without a locally-spawned exporter or QAN agent for each one.
+type Target struct {
+	Node    string
+	Address string
+}
+
+// RegisterService PUTs a Consul catalog registration for job on target,
+// with an HTTP health check against the target's own /metrics endpoint.
+// It's the same catalog/register + Check logic AddMySQL/AddMongoDB/AddOS
+// use for the local host, factored out for callers (like pkg/pmm/k8s)
+// that discover remote targets instead of monitoring their own host.
+func (a *Admin) RegisterService(target Target, job string, port uint16, tags []string) error {
+	host := ConsulNode{
+		Node:    target.Node,
+		Address: target.Address,
+		Service: ConsulService{
+			Service: job,
+			Port:    port,
+			Tags:    tags,
+			Check:   a.httpCheck(fmt.Sprintf("http://%s:%d/metrics", target.Address, port)),
+		},
+	}
+	hostBytes, _ := json.Marshal(host)
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "register")
+	ctx := WithRequestAttrs(context.Background(), target.Node, job)
+	resp, content, err := a.consulAPI().PutCtx(ctx, url, hostBytes)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return a.api.Error("PUT", url, resp.StatusCode, http.StatusOK, content)
+	}
+	return nil
+}
+
+// DeregisterService is RegisterService's inverse.
+func (a *Admin) DeregisterService(target Target, job string) error {
+	host := ConsulNode{
+		Node:      target.Node,
+		ServiceID: job,
+	}
+	hostBytes, _ := json.Marshal(host)
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "deregister")
+	resp, content, err := a.consulAPI().Put(url, hostBytes)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return a.api.Error("PUT", url, resp.StatusCode, http.StatusOK, content)
+	}
+	return nil
+}
+
+// NodesByService returns the Consul node name registered for every
+// instance of service carrying tag, via GET /v1/catalog/service/<service>.
+// pkg/pmm/k8s uses this (service "mysql"/"mongodb"/"linux", tag
+// "source=k8s") to find its own prior registrations for startup
+// reconciliation, since each pod it registers is its own Consul node
+// rather than a service on this process's own node.
+func (a *Admin) NodesByService(service, tag string) ([]string, error) {
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "service", service) + "?tag=" + tag
+	resp, bytes, err := a.consulAPI().Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, a.api.Error("GET", url, resp.StatusCode, http.StatusOK, bytes)
+	}
+
+	var entries []struct {
+		Node string
+	}
+	if string(bytes) == "null" {
+		return nil, nil
+	}
+	if err := json.Unmarshal(bytes, &entries); err != nil {
+		return nil, err
+	}
+
+	var nodes []string
+	for _, e := range entries {
+		nodes = append(nodes, e.Node)
+	}
+	return nodes, nil
+}
+
 func (a *Admin) ClientAddress() string {
-	return a.config.ClientAddress
+	return a.ctx().ClientAddress
 }
 
 func (a *Admin) OS() (proto.Instance, error) {
 	var in proto.Instance
 
-	if a.config.ClientUUID == "" {
+	if a.ctx().ClientUUID == "" {
 		return in, ErrNoOS
 	}
 
-	url := a.api.URL(a.config.ServerAddress+":"+proto.DEFAULT_QAN_API_PORT, "instances", a.config.ClientUUID)
+	url := a.api.URL(a.ctx().ServerAddress+":"+proto.DEFAULT_QAN_API_PORT, "instances", a.ctx().ClientUUID)
 	resp, bytes, err := a.api.Get(url)
 	if err != nil {
 		return in, err
@@ -183,11 +697,11 @@ func (a *Admin) AddOS(addr string, start bool, replset string, cluster string) e
 		host := ConsulNode{
 			Node:    os.Name,
 			Address: addr,
-			Service: ConsulService{Service: "linux", Port: 9100, Tags: tags},
+			Service: ConsulService{Service: "linux", Port: 9100, Tags: tags, Check: a.httpCheck(fmt.Sprintf("http://%s:9100/metrics", addr))},
 		}
 		hostBytes, _ := json.Marshal(host)
-		url := a.api.URL(a.config.ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "register")
-		resp, content, err := a.api.Put(url, hostBytes)
+		url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "register")
+		resp, content, err := a.consulAPI().Put(url, hostBytes)
 		if err != nil {
 			return err
 		}
@@ -197,8 +711,8 @@ func (a *Admin) AddOS(addr string, start bool, replset string, cluster string) e
 	}
 
 	// Set OS locally.
-	a.config.ClientAddress = addr
-	a.config.ClientUUID = os.UUID
+	a.ctx().ClientAddress = addr
+	a.ctx().ClientUUID = os.UUID
 	return a.writeConfig()
 }
 
@@ -218,8 +732,8 @@ func (a *Admin) RemoveOS(name string) error {
 		ServiceID: "linux",
 	}
 	hostBytes, _ := json.Marshal(host)
-	url := a.api.URL(a.config.ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "deregister")
-	resp, content, err := a.api.Put(url, hostBytes)
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "deregister")
+	resp, content, err := a.consulAPI().Put(url, hostBytes)
 	if err != nil {
 		return err
 	}
@@ -239,7 +753,7 @@ func (a *Admin) AddMySQL(name, dsn, source string, start bool, info map[string]s
 	var bytes []byte
 
 	// User must first add the OS which sets the client address.
-	if a.config.ClientAddress == "" {
+	if a.ctx().ClientAddress == "" {
 		return ErrNoOS
 	}
 
@@ -266,7 +780,7 @@ func (a *Admin) AddMySQL(name, dsn, source string, start bool, info map[string]s
 		Version: info["version"],
 	}
 	inBytes, _ := json.Marshal(in)
-	url := a.api.URL(a.config.ServerAddress+":"+proto.DEFAULT_QAN_API_PORT, "instances")
+	url := a.api.URL(a.ctx().ServerAddress+":"+proto.DEFAULT_QAN_API_PORT, "instances")
 	resp, content, err := a.api.Post(url, inBytes)
 	if err != nil {
 		return err
@@ -321,12 +835,12 @@ func (a *Admin) AddMySQL(name, dsn, source string, start bool, info map[string]s
 	for job, port := range map[string]uint16{"mysql-hr": 9104, "mysql-mr": 9105, "mysql-lr": 9106} {
 		host := ConsulNode{
 			Node:    name,
-			Address: a.config.ClientAddress,
-			Service: ConsulService{Service: job, Port: port},
+			Address: a.ctx().ClientAddress,
+			Service: ConsulService{Service: job, Port: port, Check: a.httpCheck(fmt.Sprintf("http://%s:%d/metrics", a.ctx().ClientAddress, port))},
 		}
 		hostBytes, _ := json.Marshal(host)
-		url = a.api.URL(a.config.ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "register")
-		resp, content, err = a.api.Put(url, hostBytes)
+		url = a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "register")
+		resp, content, err = a.consulAPI().Put(url, hostBytes)
 		if err != nil {
 			return err
 		}
@@ -375,8 +889,8 @@ func (a *Admin) RemoveMySQL(name string) error {
 			ServiceID: job,
 		}
 		hostBytes, _ := json.Marshal(host)
-		url := a.api.URL(a.config.ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "deregister")
-		resp, content, err := a.api.Put(url, hostBytes)
+		url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "deregister")
+		resp, content, err := a.consulAPI().Put(url, hostBytes)
 		if err != nil {
 			return err
 		}
@@ -422,7 +936,7 @@ func (a *Admin) RemoveMySQL(name string) error {
 
 func (a *Admin) AddMongoDB(name string, start bool, uri string, replset string, cluster string) error {
 	// User must first add the OS which sets the client address.
-	if a.config.ClientAddress == "" {
+	if a.ctx().ClientAddress == "" {
 		return ErrNoOS
 	}
 	if !start {
@@ -433,17 +947,19 @@ func (a *Admin) AddMongoDB(name string, start bool, uri string, replset string,
 	instances, err := a.localAgentInstances()
 	os := instances["os"][0]
 
-	// Check if Consul is already monitoring this MongoDB.
+	// Already monitoring this MongoDB: tolerate it like AddMySQL tolerates
+	// an existing QAN instance, so a second 'add' (e.g. from 'pmm-admin
+	// apply') converges instead of failing.
 	ok, err := a.serviceExists(os.Name, "mongodb")
 	if err != nil {
 		return err
 	}
 	if ok {
-		return fmt.Errorf("PMM is already monitoring this MongoDB instance %s", os.Name)
+		return nil
 	}
 
 	// Start mongodb_exporter via process manager API.
-	args := []string{fmt.Sprintf("-web.listen-address=%s:9107", a.config.ClientAddress)}
+	args := []string{fmt.Sprintf("-web.listen-address=%s:9107", a.ctx().ClientAddress)}
 	if uri != "" {
 		args = append(args, fmt.Sprintf("-mongodb.uri=%s", uri))
 	}
@@ -468,12 +984,12 @@ func (a *Admin) AddMongoDB(name string, start bool, uri string, replset string,
 
 	host := ConsulNode{
 		Node:    os.Name,
-		Address: a.config.ClientAddress,
-		Service: ConsulService{Service: "mongodb", Port: 9107, Tags: tags},
+		Address: a.ctx().ClientAddress,
+		Service: ConsulService{Service: "mongodb", Port: 9107, Tags: tags, Check: a.httpCheck(fmt.Sprintf("http://%s:9107/metrics", a.ctx().ClientAddress))},
 	}
 	hostBytes, _ := json.Marshal(host)
-	url := a.api.URL(a.config.ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "register")
-	resp, content, err := a.api.Put(url, hostBytes)
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "register")
+	resp, content, err := a.consulAPI().Put(url, hostBytes)
 	if err != nil {
 		return err
 	}
@@ -500,8 +1016,8 @@ func (a *Admin) RemoveMongoDB(name string) error {
 		ServiceID: "mongodb",
 	}
 	hostBytes, _ := json.Marshal(host)
-	url := a.api.URL(a.config.ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "deregister")
-	resp, content, err := a.api.Put(url, hostBytes)
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "deregister")
+	resp, content, err := a.consulAPI().Put(url, hostBytes)
 	if err != nil {
 		return err
 	}
@@ -517,91 +1033,350 @@ func (a *Admin) RemoveMongoDB(name string) error {
 	return nil
 }
 
-func (a *Admin) List() (map[string][]InstanceStatus, error) {
+func (a *Admin) AddPostgreSQL(name, dsn string, start bool, info map[string]string) error {
 	// User must first add the OS which sets the client address.
-	if a.config.ClientAddress == "" {
-		return nil, ErrNoOS
+	if a.ctx().ClientAddress == "" {
+		return ErrNoOS
+	}
+	if !start {
+		return nil
 	}
 
-	// Agent creates an OS instance on install. Use its name for the Prom host alias.
-	agent_instances, err := a.localAgentInstances()
-	os := agent_instances["os"][0]
+	// Already monitoring this PostgreSQL: tolerate it like AddMySQL
+	// tolerates an existing QAN instance, so a second 'add' (e.g. from
+	// 'pmm-admin apply') converges instead of failing.
+	ok, err := a.serviceExists(name, "postgresql")
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
 
-	status := map[string][]InstanceStatus{
-		"os":      []InstanceStatus{},
-		"mysql":   []InstanceStatus{},
-		"mongodb": []InstanceStatus{},
+	// Start postgres_exporter via process manager API.
+	exp := proto.Exporter{
+		Name:  "postgres_exporter",
+		Alias: "PostgreSQL metrics",
+		Port:  "9187",
+		Args: []string{
+			fmt.Sprintf("-web.listen-address=%s:9187", a.ctx().ClientAddress),
+			fmt.Sprintf("-datasource.name=%s", dsn),
+		},
+	}
+	if err := a.startExporter(exp); err != nil {
+		return err
 	}
 
-	// curl http://192.168.56.107:8500/v1/catalog/node/centos7.vm
-	url := a.api.URL(a.config.ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "node", os.Name)
-	resp, bytes, err := a.api.Get(url)
+	// Add postgresql service to Consul.
+	host := ConsulNode{
+		Node:    name,
+		Address: a.ctx().ClientAddress,
+		Service: ConsulService{Service: "postgresql", Port: 9187, Check: a.httpCheck(fmt.Sprintf("http://%s:9187/metrics", a.ctx().ClientAddress))},
+	}
+	hostBytes, _ := json.Marshal(host)
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "register")
+	resp, content, err := a.consulAPI().Put(url, hostBytes)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, a.api.Error("GET", url, resp.StatusCode, http.StatusOK, bytes)
+		return a.api.Error("PUT", url, resp.StatusCode, http.StatusOK, content)
 	}
 
-	var data interface{}
-	if string(bytes) == "null" {
-		// Node does not exist
-		return nil, nil
-	} else if err = json.Unmarshal(bytes, &data); err != nil {
-		// Node exists
-		return nil, err
-	}
+	return nil
+}
 
-	// Check services
-	for action, job := range map[string]string{"os": "linux", "mysql": "mysql-hr", "mongodb": "mongodb"} {
-		if services, ok := data.(map[string]interface{})["Services"]; ok {
-			if srv, ok := services.(map[string]interface{})[job]; ok {
-				ins := InstanceStatus{
-					Type: job,
-					Name: os.Name,
-					Tags: srv.(map[string]interface{})["Tags"],
-				}
-				status[action] = append(status[action], ins)
-			}
-		}
+func (a *Admin) RemovePostgreSQL(name string) error {
+	// Check if Consul is already monitoring this PostgreSQL.
+	ok, err := a.serviceExists(name, "postgresql")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("PMM is not monitoring this PostgreSQL instance")
 	}
 
-	// Get local agent configs which contains any QAN configs it's running.
-	var configs []proto.AgentConfig
-	url = a.api.URL("localhost:"+proto.DEFAULT_AGENT_API_PORT, "configs")
-	resp, bytes, err = a.api.Get(url)
+	// Remove service from Consul.
+	host := ConsulNode{
+		Node:      name,
+		ServiceID: "postgresql",
+	}
+	hostBytes, _ := json.Marshal(host)
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "deregister")
+	resp, content, err := a.consulAPI().Put(url, hostBytes)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, a.api.Error("GET", url, resp.StatusCode, http.StatusOK, bytes)
+		return a.api.Error("PUT", url, resp.StatusCode, http.StatusOK, content)
 	}
-	if err := json.Unmarshal(bytes, &configs); err != nil {
-		return nil, err
+
+	// Stop postgres_exporter process.
+	if err := a.stopExporter("postgres_exporter", "9187"); err != nil {
+		return err
 	}
 
-	// Get local agent instance to verify that Prom MySQL host = agent QAN host.
-	var instances map[string][]proto.Instance
-	url = a.api.URL("localhost:"+proto.DEFAULT_AGENT_API_PORT, "instances")
-	resp, bytes, err = a.api.Get(url)
+	return nil
+}
+
+func (a *Admin) AddProxySQL(name, dsn string, start bool, info map[string]string) error {
+	// User must first add the OS which sets the client address.
+	if a.ctx().ClientAddress == "" {
+		return ErrNoOS
+	}
+	if !start {
+		return nil
+	}
+
+	// Already monitoring this ProxySQL: tolerate it like AddMySQL
+	// tolerates an existing QAN instance, so a second 'add' (e.g. from
+	// 'pmm-admin apply') converges instead of failing.
+	ok, err := a.serviceExists(name, "proxysql")
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, a.api.Error("GET", url, resp.StatusCode, http.StatusOK, bytes)
+	if ok {
+		return nil
 	}
-	if err := json.Unmarshal(bytes, &instances); err != nil {
-		return nil, err
+
+	// Start proxysql_exporter via process manager API.
+	exp := proto.Exporter{
+		Name:  "proxysql_exporter",
+		Alias: "ProxySQL metrics",
+		Port:  "42004",
+		Args: []string{
+			fmt.Sprintf("-web.listen-address=%s:42004", a.ctx().ClientAddress),
+			fmt.Sprintf("-dsn=%s", dsn),
+		},
+	}
+	if err := a.startExporter(exp); err != nil {
+		return err
 	}
 
-	// If Prom and agent have an OS instance with the same name, set its UUID.
-	//if len(instances["os"]) > 0 && instances["os"][0].Name == os.Name {
-	//	status["os"][0].UUID = instances["os"][0].UUID
-	//}
+	// Add proxysql service to Consul.
+	host := ConsulNode{
+		Node:    name,
+		Address: a.ctx().ClientAddress,
+		Service: ConsulService{Service: "proxysql", Port: 42004, Check: a.httpCheck(fmt.Sprintf("http://%s:42004/metrics", a.ctx().ClientAddress))},
+	}
+	hostBytes, _ := json.Marshal(host)
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "register")
+	resp, content, err := a.consulAPI().Put(url, hostBytes)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return a.api.Error("PUT", url, resp.StatusCode, http.StatusOK, content)
+	}
 
-	// Check if the local agent is running QAN for the same MySQL host;
-	// it should be.
-	//var mysqlHost interface{}
+	return nil
+}
+
+func (a *Admin) RemoveProxySQL(name string) error {
+	// Check if Consul is already monitoring this ProxySQL.
+	ok, err := a.serviceExists(name, "proxysql")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("PMM is not monitoring this ProxySQL instance")
+	}
+
+	// Remove service from Consul.
+	host := ConsulNode{
+		Node:      name,
+		ServiceID: "proxysql",
+	}
+	hostBytes, _ := json.Marshal(host)
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "deregister")
+	resp, content, err := a.consulAPI().Put(url, hostBytes)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return a.api.Error("PUT", url, resp.StatusCode, http.StatusOK, content)
+	}
+
+	// Stop proxysql_exporter process.
+	if err := a.stopExporter("proxysql_exporter", "42004"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// checkStatuses returns, for every service ID registered on node, its
+// worst Consul health check status ("passing", "warning", or "critical").
+// A service with no checks (e.g. added before ConsulCheck existed) is
+// simply absent from the map, not assumed passing.
+func (a *Admin) checkStatuses(node string) (map[string]string, error) {
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "health", "node", node)
+	resp, bytes, err := a.consulAPI().Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, a.api.Error("GET", url, resp.StatusCode, http.StatusOK, bytes)
+	}
+
+	var checks []HealthCheck
+	if err := json.Unmarshal(bytes, &checks); err != nil {
+		return nil, err
+	}
+
+	statuses := map[string]string{}
+	for _, c := range checks {
+		if c.ServiceID == "" {
+			continue // node-level check (e.g. Consul's built-in serfHealth), not a service
+		}
+		if checkStatusRank[c.Status] > checkStatusRank[statuses[c.ServiceID]] {
+			statuses[c.ServiceID] = c.Status
+		}
+	}
+	return statuses, nil
+}
+
+var checkStatusRank = map[string]int{"passing": 0, "warning": 1, "critical": 2}
+
+// Checks returns the non-"passing" checks on this node, keyed by service
+// ID, for 'pmm-admin check'.
+func (a *Admin) Checks() (map[string]string, error) {
+	if a.ctx().ClientAddress == "" {
+		return nil, ErrNoOS
+	}
+
+	agentInstances, err := a.localAgentInstances()
+	if err != nil {
+		return nil, err
+	}
+	node := agentInstances["os"][0]
+
+	statuses, err := a.checkStatuses(node.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	failing := map[string]string{}
+	for service, status := range statuses {
+		if status != "passing" {
+			failing[service] = status
+		}
+	}
+	return failing, nil
+}
+
+func (a *Admin) List() (map[string][]InstanceStatus, error) {
+	// User must first add the OS which sets the client address.
+	if a.ctx().ClientAddress == "" {
+		return nil, ErrNoOS
+	}
+
+	// Agent creates an OS instance on install. Use its name for the Prom host alias.
+	agent_instances, err := a.localAgentInstances()
+	os := agent_instances["os"][0]
+
+	status := map[string][]InstanceStatus{
+		"os":         []InstanceStatus{},
+		"mysql":      []InstanceStatus{},
+		"mongodb":    []InstanceStatus{},
+		"postgresql": []InstanceStatus{},
+		"proxysql":   []InstanceStatus{},
+	}
+
+	// A Consul health-check lookup failure (ACL denial, a transient 5xx, a
+	// Consul version without that endpoint) shouldn't abort the whole
+	// listing - CheckStatus just comes back empty, same as watchServices
+	// treats this error.
+	checkStatuses, err := a.checkStatuses(os.Name)
+	if err != nil {
+		checkStatuses = map[string]string{}
+	}
+
+	// curl http://192.168.56.107:8500/v1/catalog/node/centos7.vm
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "node", os.Name)
+	resp, bytes, err := a.consulAPI().Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, a.api.Error("GET", url, resp.StatusCode, http.StatusOK, bytes)
+	}
+
+	var data interface{}
+	if string(bytes) == "null" {
+		// Node does not exist
+		return nil, nil
+	} else if err = json.Unmarshal(bytes, &data); err != nil {
+		// Node exists
+		return nil, err
+	}
+
+	// Check services
+	jobs := map[string]string{
+		"os":         "linux",
+		"mysql":      "mysql-hr",
+		"mongodb":    "mongodb",
+		"postgresql": "postgresql",
+		"proxysql":   "proxysql",
+	}
+	for action, job := range jobs {
+		if services, ok := data.(map[string]interface{})["Services"]; ok {
+			if srv, ok := services.(map[string]interface{})[job]; ok {
+				ins := InstanceStatus{
+					Type:        job,
+					Name:        os.Name,
+					Tags:        srv.(map[string]interface{})["Tags"],
+					CheckStatus: checkStatuses[job],
+					Address:     a.ctx().ClientAddress,
+				}
+				status[action] = append(status[action], ins)
+			}
+		}
+	}
+
+	// Get local agent configs which contains any QAN configs it's running.
+	var configs []proto.AgentConfig
+	url = a.api.URL("localhost:"+proto.DEFAULT_AGENT_API_PORT, "configs")
+	resp, bytes, err = a.api.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, a.api.Error("GET", url, resp.StatusCode, http.StatusOK, bytes)
+	}
+	if err := json.Unmarshal(bytes, &configs); err != nil {
+		return nil, err
+	}
+
+	// Get local agent instance to verify that Prom MySQL host = agent QAN host.
+	var instances map[string][]proto.Instance
+	url = a.api.URL("localhost:"+proto.DEFAULT_AGENT_API_PORT, "instances")
+	resp, bytes, err = a.api.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, a.api.Error("GET", url, resp.StatusCode, http.StatusOK, bytes)
+	}
+	if err := json.Unmarshal(bytes, &instances); err != nil {
+		return nil, err
+	}
+
+	// Fill in the masked DSN for mysql from the agent's instance record; no
+	// other instance type's DSN is retrievable after add (see
+	// InstanceStatus.DSNMasked).
+	if len(instances["mysql"]) > 0 && len(status["mysql"]) > 0 {
+		status["mysql"][0].DSNMasked = dsn.HidePassword(instances["mysql"][0].DSN)
+	}
+
+	// If Prom and agent have an OS instance with the same name, set its UUID.
+	//if len(instances["os"]) > 0 && instances["os"][0].Name == os.Name {
+	//	status["os"][0].UUID = instances["os"][0].UUID
+	//}
+
+	// Check if the local agent is running QAN for the same MySQL host;
+	// it should be.
+	//var mysqlHost interface{}
 	//for _, config := range configs {
 	//	if config.Service != "qan" {
 	//		continue
@@ -636,6 +1411,27 @@ func (a *Admin) List() (map[string][]InstanceStatus, error) {
 	//	status["mysql"] = append(status["mysql"], ins)
 	//}
 
+	backups, err := a.ListBackups("")
+	if err != nil {
+		return nil, err
+	}
+	status["backups"] = []InstanceStatus{}
+	for _, job := range backups {
+		last := "scheduled"
+		if job.Completed {
+			last = "last run failed"
+			if job.Succeeded {
+				last = "last run succeeded"
+			}
+		}
+		status["backups"] = append(status["backups"], InstanceStatus{
+			Type:        "backups",
+			Name:        job.Name,
+			Tags:        []interface{}{"schedule=" + job.Schedule, "destination=" + job.Destination},
+			CheckStatus: last,
+		})
+	}
+
 	return status, nil
 }
 
@@ -692,7 +1488,7 @@ func (a *Admin) startMySQLExporters(uuid string) error {
 		Port:         "9104",
 		InstanceUUID: uuid,
 		Args: []string{
-			"-web.listen-address=" + a.config.ClientAddress + ":9104",
+			"-web.listen-address=" + a.ctx().ClientAddress + ":9104",
 			"-collect.global_status=true",
 			"-collect.global_variables=false",
 			"-collect.slave_status=false",
@@ -723,7 +1519,7 @@ func (a *Admin) startMySQLExporters(uuid string) error {
 		Port:         "9105",
 		InstanceUUID: uuid,
 		Args: []string{
-			"-web.listen-address=" + a.config.ClientAddress + ":9105",
+			"-web.listen-address=" + a.ctx().ClientAddress + ":9105",
 			"-collect.global_status=false",
 			"-collect.global_variables=false",
 			"-collect.slave_status=true",
@@ -754,7 +1550,7 @@ func (a *Admin) startMySQLExporters(uuid string) error {
 		Port:         "9106",
 		InstanceUUID: uuid,
 		Args: []string{
-			"-web.listen-address=" + a.config.ClientAddress + ":9106",
+			"-web.listen-address=" + a.ctx().ClientAddress + ":9106",
 			"-collect.global_status=false",
 			"-collect.global_variables=true",
 			"-collect.slave_status=false",
@@ -846,7 +1642,7 @@ func (a *Admin) startQAN(agentId string, in proto.Instance, config map[string]st
 
 	// Send the StartTool cmd to the API which relays it to the agent, then
 	// relays the agent's reply back to here.
-	url := a.api.URL(a.config.ServerAddress+":"+proto.DEFAULT_QAN_API_PORT, "agents", agentId, "cmd")
+	url := a.api.URL(a.ctx().ServerAddress+":"+proto.DEFAULT_QAN_API_PORT, "agents", agentId, "cmd")
 	resp, content, err := a.api.Put(url, cmdBytes)
 	if err != nil {
 		return err
@@ -869,7 +1665,7 @@ func (a *Admin) stopQAN(agentId string, in proto.Instance) error {
 
 	// Send the StartTool cmd to the API which relays it to the agent, then
 	// relays the agent's reply back to here.
-	url := a.api.URL(a.config.ServerAddress+":"+proto.DEFAULT_QAN_API_PORT, "agents", agentId, "cmd")
+	url := a.api.URL(a.ctx().ServerAddress+":"+proto.DEFAULT_QAN_API_PORT, "agents", agentId, "cmd")
 	resp, content, err := a.api.Put(url, cmdBytes)
 	if err != nil {
 		return err
@@ -881,32 +1677,1127 @@ func (a *Admin) stopQAN(agentId string, in proto.Instance) error {
 	return nil
 }
 
-func (a *Admin) serviceExists(host string, job string) (bool, error) {
-	// Check if node service exists on Consul
-	url := a.api.URL(a.config.ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "node", host)
-	resp, bytes, err := a.api.Get(url)
+// --------------------------------------------------------------------------
+// Backups
+
+// BackupCondition is one timestamped state a BackupJob has passed
+// through (e.g. "Scheduled", "Running", "Completed"), mirroring how the
+// BackupJob's status separates "it finished" from "it succeeded" instead
+// of collapsing both into a single status string.
+type BackupCondition struct {
+	Type    string `json:"type" yaml:"type"`
+	Status  string `json:"status" yaml:"status"` // "True", "False", or "Unknown"
+	Reason  string `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// BackupJob is one xtrabackup schedule (or one-off run, when Schedule is
+// "") tracked for a MySQL instance. Completed and Succeeded are kept
+// separate so a backup that finished but failed (Completed=true,
+// Succeeded=false) is distinguishable from one still in progress.
+type BackupJob struct {
+	UUID         string            `json:"uuid" yaml:"uuid"`
+	InstanceUUID string            `json:"instance_uuid" yaml:"instance_uuid"`
+	Name         string            `json:"name" yaml:"name"`
+	Schedule     string            `json:"schedule,omitempty" yaml:"schedule,omitempty"` // cron expression
+	Destination  string            `json:"destination" yaml:"destination"`               // s3://, file://, or gs:// URL
+	Retention    string            `json:"retention,omitempty" yaml:"retention,omitempty"`
+	Completed    bool              `json:"completed" yaml:"completed"`
+	Succeeded    bool              `json:"succeeded" yaml:"succeeded"`
+	LastStatus   string            `json:"last_status,omitempty" yaml:"last_status,omitempty"`
+	Conditions   []BackupCondition `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+}
+
+// AddBackupSchedule creates a BackupJob for the named MySQL instance,
+// persisted via the local agent's /backups endpoint and mirrored to
+// Consul KV so the server UI can list it without querying the agent.
+func (a *Admin) AddBackupSchedule(name, cron, destination, retention string) error {
+	instanceUUID, err := a.mysqlInstanceUUID(name)
 	if err != nil {
-		return false, err
+		return err
+	}
+
+	job := BackupJob{
+		InstanceUUID: instanceUUID,
+		Name:         name,
+		Schedule:     cron,
+		Destination:  destination,
+		Retention:    retention,
+		Conditions:   []BackupCondition{{Type: "Scheduled", Status: "True"}},
+	}
+	jobBytes, _ := json.Marshal(job)
+	url := a.api.URL("localhost:"+proto.DEFAULT_AGENT_API_PORT, "backups")
+	resp, content, err := a.api.Post(url, jobBytes)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusConflict:
+		return fmt.Errorf("a backup schedule already exists for %s", name)
+	default:
+		return a.api.Error("POST", url, resp.StatusCode, http.StatusCreated, content)
+	}
+
+	// The URI of the new job is reported in the Location header; fetch it
+	// to get its UUID, same as AddMySQL does for the instance it creates.
+	url = resp.Header.Get("Location")
+	resp, content, err = a.api.Get(url)
+	if err != nil {
+		return err
 	}
 	if resp.StatusCode != http.StatusOK {
-		return false, a.api.Error("GET", url, resp.StatusCode, http.StatusOK, bytes)
+		return a.api.Error("GET", url, resp.StatusCode, http.StatusOK, content)
+	}
+	if err := json.Unmarshal(content, &job); err != nil {
+		return err
 	}
 
-	var data interface{}
-	if string(bytes) == "null" {
-		// Node does not exist
-		return false, nil
-	} else if err = json.Unmarshal(bytes, &data); err != nil {
-		// Node exists
-		return false, err
+	return a.mirrorBackupKV(job)
+}
+
+// RunBackupNow launches an immediate xtrabackup run for name's most
+// recent BackupJob through the process-manager API, the same pattern
+// startExporter uses to launch mysqld_exporter, then records whether it
+// completed and succeeded.
+func (a *Admin) RunBackupNow(name string) error {
+	job, err := a.findBackupJob(name)
+	if err != nil {
+		return err
 	}
 
-	// Check service
-	if val, ok := data.(map[string]interface{})["Services"]; ok {
-		if _, ok := val.(map[string]interface{})[job]; ok {
-			return true, nil
+	// The process manager treats this like any other managed process: it
+	// just happens to run once and exit instead of serving metrics
+	// forever. Destination is passed through as an arg; the agent decides
+	// how to stream xbstream output to it based on the URL scheme.
+	exp := proto.Exporter{
+		Name:         "xtrabackup",
+		Alias:        fmt.Sprintf("Backup of %s", name),
+		InstanceUUID: job.InstanceUUID,
+		Args: []string{
+			"--stream=xbstream",
+			"--destination=" + job.Destination,
+		},
+	}
+
+	job.Conditions = append(job.Conditions, BackupCondition{Type: "Running", Status: "True"})
+	if err := a.startExporter(exp); err != nil {
+		job.Completed = true
+		job.Succeeded = false
+		job.LastStatus = err.Error()
+		job.Conditions = append(job.Conditions, BackupCondition{Type: "Completed", Status: "True", Reason: "StartFailed", Message: err.Error()})
+		a.saveBackupJob(job) // best-effort; the start error is what matters to the caller
+		return err
+	}
+
+	job.Completed = true
+	job.Succeeded = true
+	job.LastStatus = "backup completed"
+	job.Conditions = append(job.Conditions, BackupCondition{Type: "Completed", Status: "True", Reason: "Succeeded"})
+	return a.saveBackupJob(job)
+}
+
+// ListBackups returns every backup job the local agent tracks, or only
+// those for the named MySQL instance if name is not "". Older agents
+// without the /backups endpoint report no backup jobs rather than an
+// error.
+func (a *Admin) ListBackups(name string) ([]BackupJob, error) {
+	url := a.api.URL("localhost:"+proto.DEFAULT_AGENT_API_PORT, "backups")
+	resp, content, err := a.api.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, a.api.Error("GET", url, resp.StatusCode, http.StatusOK, content)
+	}
+
+	var jobs []BackupJob
+	if err := json.Unmarshal(content, &jobs); err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return jobs, nil
+	}
+
+	var filtered []BackupJob
+	for _, j := range jobs {
+		if j.Name == name {
+			filtered = append(filtered, j)
 		}
 	}
-	// Node exists but no service
-	return false, nil
+	return filtered, nil
+}
+
+// RemoveBackupSchedule deletes name's backup job from the local agent and
+// its Consul KV mirror.
+func (a *Admin) RemoveBackupSchedule(name string) error {
+	job, err := a.findBackupJob(name)
+	if err != nil {
+		return err
+	}
+
+	url := a.api.URL("localhost:"+proto.DEFAULT_AGENT_API_PORT, "backups", job.UUID)
+	resp, content, err := a.api.Delete(url)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return a.api.Error("DELETE", url, resp.StatusCode, http.StatusOK, content)
+	}
+
+	return a.removeBackupKV(job.UUID)
+}
+
+func (a *Admin) findBackupJob(name string) (BackupJob, error) {
+	jobs, err := a.ListBackups(name)
+	if err != nil {
+		return BackupJob{}, err
+	}
+	if len(jobs) == 0 {
+		return BackupJob{}, fmt.Errorf("no backup schedule for %s; run 'pmm-admin backup add %s ...' first", name, name)
+	}
+	return jobs[len(jobs)-1], nil
+}
+
+func (a *Admin) saveBackupJob(job BackupJob) error {
+	jobBytes, _ := json.Marshal(job)
+	url := a.api.URL("localhost:"+proto.DEFAULT_AGENT_API_PORT, "backups", job.UUID)
+	resp, content, err := a.api.Put(url, jobBytes)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return a.api.Error("PUT", url, resp.StatusCode, http.StatusOK, content)
+	}
+	return a.mirrorBackupKV(job)
+}
+
+// mirrorBackupKV writes job to Consul KV under pmm/backups/<uuid>, so the
+// server UI can list backup jobs without querying every agent directly.
+func (a *Admin) mirrorBackupKV(job BackupJob) error {
+	jobBytes, _ := json.Marshal(job)
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "kv", "pmm/backups/"+job.UUID)
+	resp, content, err := a.consulAPI().Put(url, jobBytes)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return a.api.Error("PUT", url, resp.StatusCode, http.StatusOK, content)
+	}
+	return nil
+}
+
+func (a *Admin) removeBackupKV(uuid string) error {
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "kv", "pmm/backups/"+uuid)
+	resp, content, err := a.consulAPI().Delete(url)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return a.api.Error("DELETE", url, resp.StatusCode, http.StatusOK, content)
+	}
+	return nil
+}
+
+// mysqlInstanceUUID looks up the local agent's UUID for the named MySQL
+// instance, the same lookup AddBackupSchedule and RunBackupNow both need.
+func (a *Admin) mysqlInstanceUUID(name string) (string, error) {
+	instances, err := a.localAgentInstances()
+	if err != nil {
+		return "", err
+	}
+	for _, in := range instances["mysql"] {
+		if in.Name == name {
+			return in.UUID, nil
+		}
+	}
+	return "", fmt.Errorf("MySQL instance %s not found; run 'pmm-admin add mysql' first", name)
+}
+
+func (a *Admin) serviceExists(host string, job string) (bool, error) {
+	// Check if node service exists on Consul
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "node", host)
+	ctx := WithRequestAttrs(context.Background(), host, job)
+	resp, bytes, err := a.consulAPI().GetCtx(ctx, url)
+	if err != nil {
+		return false, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, a.api.Error("GET", url, resp.StatusCode, http.StatusOK, bytes)
+	}
+
+	var data interface{}
+	if string(bytes) == "null" {
+		// Node does not exist
+		return false, nil
+	} else if err = json.Unmarshal(bytes, &data); err != nil {
+		// Node exists
+		return false, err
+	}
+
+	// Check service
+	if val, ok := data.(map[string]interface{})["Services"]; ok {
+		if _, ok := val.(map[string]interface{})[job]; ok {
+			return true, nil
+		}
+	}
+	// Node exists but no service
+	return false, nil
+}
+
+// --------------------------------------------------------------------------
+// Watching for drift
+
+// ServiceEventType is the kind of change WatchServices reports.
+type ServiceEventType string
+
+const (
+	ServiceAdded         ServiceEventType = "added"
+	ServiceRemoved       ServiceEventType = "removed"
+	ServiceHealthChanged ServiceEventType = "health_changed"
+)
+
+// ServiceEvent is one change WatchServices detected in a node's
+// registered services between two blocking-query reads. Status is the
+// service's current worst check status (see checkStatusRank); it's only
+// meaningful for ServiceAdded and ServiceHealthChanged.
+type ServiceEvent struct {
+	Type    ServiceEventType
+	Service string
+	Status  string
+}
+
+// watchWaitTime is how long each blocking query asks Consul to hold the
+// connection open waiting for a change, matching Consul's own default.
+const watchWaitTime = "30s"
+
+// watchMaxBackoff caps how long WatchServices waits between retries
+// after a run of failed/5xx responses.
+const watchMaxBackoff = 30 * time.Second
+
+// WatchServices streams add/remove/health-change events for host's
+// registered services using Consul's blocking queries
+// (?index=N&wait=30s against /v1/catalog/node/<host>, tracking the
+// X-Consul-Index response header across calls) instead of polling
+// serviceExists/checkStatuses on every command. Because Consul only
+// returns from a blocking query once something has actually changed,
+// several rapid changes within one wait window naturally arrive as a
+// single diff instead of one event per change, so no separate
+// debouncing is needed.
+//
+// The returned channel is closed when ctx is done or a non-retriable
+// error occurs; connection errors and 5xx responses are retried with
+// exponential backoff up to watchMaxBackoff instead of stopping the
+// watch.
+func (a *Admin) WatchServices(ctx context.Context, host string) (<-chan ServiceEvent, error) {
+	events := make(chan ServiceEvent)
+	go a.watchServices(ctx, host, events)
+	return events, nil
+}
+
+func (a *Admin) watchServices(ctx context.Context, host string, events chan<- ServiceEvent) {
+	defer close(events)
+
+	index := "0"
+	backoff := time.Second
+	known := map[string]string{} // service -> last-seen status
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "node", host) +
+			fmt.Sprintf("?index=%s&wait=%s", index, watchWaitTime)
+		resp, content, err := a.consulAPI().Get(url)
+		if err != nil {
+			if !sleepOrDone(ctx, backoff) {
+				return
+			}
+			backoff = nextWatchBackoff(backoff)
+			continue
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			if !sleepOrDone(ctx, backoff) {
+				return
+			}
+			backoff = nextWatchBackoff(backoff)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			// Not retriable (e.g. a bad ACL token): stop instead of
+			// spinning forever on the same error.
+			return
+		}
+		backoff = time.Second
+
+		if newIndex := resp.Header.Get("X-Consul-Index"); newIndex != "" {
+			if newIndex == index {
+				// Nothing changed (Consul can return early); wait again
+				// without re-diffing.
+				continue
+			}
+			index = newIndex
+		}
+
+		current, err := parseNodeServices(content)
+		if err != nil {
+			continue // transient parse issue; retry on the next wait
+		}
+		statuses, err := a.checkStatuses(host)
+		if err != nil {
+			statuses = map[string]string{}
+		}
+
+		for svc := range current {
+			if _, ok := known[svc]; !ok {
+				if !sendOrDone(ctx, events, ServiceEvent{Type: ServiceAdded, Service: svc, Status: statuses[svc]}) {
+					return
+				}
+			} else if known[svc] != statuses[svc] {
+				if !sendOrDone(ctx, events, ServiceEvent{Type: ServiceHealthChanged, Service: svc, Status: statuses[svc]}) {
+					return
+				}
+			}
+		}
+		for svc := range known {
+			if !current[svc] {
+				if !sendOrDone(ctx, events, ServiceEvent{Type: ServiceRemoved, Service: svc}) {
+					return
+				}
+			}
+		}
+
+		known = map[string]string{}
+		for svc := range current {
+			known[svc] = statuses[svc]
+		}
+	}
+}
+
+// consulNodeServices is the subset of a Consul GET
+// /v1/catalog/node/<node> response WatchServices/serviceExists need.
+type consulNodeServices struct {
+	Services map[string]struct {
+		Service string
+	}
+}
+
+// parseNodeServices extracts the set of job names registered on a node
+// from a /v1/catalog/node/<node> response body.
+func parseNodeServices(content []byte) (map[string]bool, error) {
+	if string(content) == "null" {
+		return map[string]bool{}, nil
+	}
+	var data consulNodeServices
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, err
+	}
+	services := map[string]bool{}
+	for _, svc := range data.Services {
+		services[svc.Service] = true
+	}
+	return services, nil
+}
+
+// sendOrDone sends event on events, returning false without sending if
+// ctx is done first.
+func sendOrDone(ctx context.Context, events chan<- ServiceEvent, event ServiceEvent) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case events <- event:
+		return true
+	}
+}
+
+// sleepOrDone waits d, returning false early if ctx is done first.
+func sleepOrDone(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func nextWatchBackoff(d time.Duration) time.Duration {
+	d *= 2
+	if d > watchMaxBackoff {
+		d = watchMaxBackoff
+	}
+	return d
+}
+
+// --------------------------------------------------------------------------
+// Migration from legacy agents
+
+// Legacy config file/directory locations this version of pmm-admin knows
+// how to migrate from. percona-agent and pt-agent (which reused
+// percona-agent's config format) both predate PMM and Consul-based
+// registration.
+const (
+	legacyPerconaAgentConfig = "/usr/local/percona/percona-agent/config/agent.conf"
+	legacyPerconaAgentDir    = "/usr/local/percona/percona-agent"
+	legacyPtAgentConfig      = "/root/.pt-agent.conf"
+	legacyPtAgentDir         = "/root/.pt-agent.d"
+)
+
+// legacyAgentConfig is the subset of percona-agent's (and pt-agent's)
+// config/agent.conf this migration needs: enough to adopt its identity
+// rather than registering this host as if it were brand new.
+type legacyAgentConfig struct {
+	AgentUuid   string
+	ApiKey      string
+	ApiHostname string
+}
+
+// legacyMySQLConfig is one config/mysql-*.conf: percona-agent keeps one
+// per monitored MySQL instance.
+type legacyMySQLConfig struct {
+	Name string
+	DSN  string
+}
+
+// legacyQANConfig is one config/qan-*.conf, named after the MySQL
+// instance it belongs to. CollectFrom is percona-agent's equivalent of
+// the "source" argument AddMySQL/startQAN take.
+type legacyQANConfig struct {
+	UUID        string
+	CollectFrom string
+}
+
+// MigrationReport summarizes what Migrate did with each legacy install
+// and instance it found. Adopted entries already had a matching Consul
+// registration and were linked up rather than re-added; Skipped means
+// nothing was found to migrate; Failed carries the error inline since
+// the CLI only needs to print these, not act on them programmatically.
+type MigrationReport struct {
+	Adopted []string
+	Skipped []string
+	Failed  []string
+}
+
+// Migrate scans this host for a standalone percona-agent or pt-agent
+// install, stops it, backs up its config tree to "<dir>.bak", and
+// replays what it was monitoring (the OS itself, any MySQL DSNs, and
+// their QAN CollectFrom settings) through AddOS/AddMySQL against the
+// current context's ServerAddress. A pre-context pmm.yml migrated by
+// LoadConfig is reported too, since it's the same "bring an old install
+// up to date" operation from the operator's point of view.
+//
+// If a legacy agent already holds a Consul registration for this host
+// or instance (e.g. a previous migrate attempt partially succeeded, or
+// two agents happen to share a Consul), that registration is adopted
+// instead of creating a duplicate.
+func (a *Admin) Migrate() (MigrationReport, error) {
+	var report MigrationReport
+
+	legacyAgents := []struct {
+		name       string
+		configPath string
+		configDir  string
+		services   []string
+	}{
+		{"percona-agent", legacyPerconaAgentConfig, legacyPerconaAgentDir, []string{"percona-agent"}},
+		{"pt-agent", legacyPtAgentConfig, legacyPtAgentDir, []string{"pt-agent"}},
+	}
+
+	found := false
+	for _, legacy := range legacyAgents {
+		if !FileExists(legacy.configPath) {
+			continue
+		}
+		found = true
+		if err := a.migrateLegacyAgent(legacy.name, legacy.configPath, legacy.configDir, legacy.services, &report); err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("%s: %s", legacy.name, err))
+		}
+	}
+
+	if a.legacyConfigMigrated {
+		found = true
+		report.Adopted = append(report.Adopted, fmt.Sprintf("pmm-client: migrated pre-context pmm.yml into context %q", DefaultContext))
+	}
+
+	if !found {
+		report.Skipped = append(report.Skipped, "no legacy percona-agent, pt-agent, or pre-context pmm-client install found")
+	}
+
+	return report, nil
+}
+
+// migrateLegacyAgent migrates one percona-agent-style install: stop it,
+// back up its config, then adopt or add its OS and MySQL instances.
+func (a *Admin) migrateLegacyAgent(name, configPath, configDir string, services []string, report *MigrationReport) error {
+	cfgBytes, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	var cfg legacyAgentConfig
+	if err := json.Unmarshal(cfgBytes, &cfg); err != nil {
+		return fmt.Errorf("parsing %s: %s", configPath, err)
+	}
+
+	if err := stopLegacyService(services); err != nil {
+		return fmt.Errorf("stopping %s: %s", name, err)
+	}
+
+	// Read the legacy MySQL/QAN configs before backupLegacyConfig renames
+	// configDir aside - once it's moved, a Glob against the original path
+	// just silently matches nothing instead of erroring.
+	mysqlConfigs, err := readLegacyMySQLConfigs(configDir)
+	if err != nil {
+		return fmt.Errorf("reading MySQL configs: %s", err)
+	}
+	qanConfigs := map[string]legacyQANConfig{}
+	for _, mc := range mysqlConfigs {
+		if qc, ok := readLegacyQANConfig(configDir, mc.Name); ok {
+			qanConfigs[mc.Name] = qc
+		}
+	}
+
+	if err := backupLegacyConfig(configDir); err != nil {
+		return fmt.Errorf("backing up %s: %s", configDir, err)
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	addr := cfg.ApiHostname
+	if addr == "" {
+		addr = host
+	}
+
+	exists, err := a.serviceExists(host, "linux")
+	if err != nil {
+		return err
+	}
+	if exists {
+		// The legacy agent already registered this host; adopt its
+		// UUID instead of AddOS-ing a duplicate "os" entry for it.
+		a.ctx().ClientAddress = addr
+		a.ctx().ClientUUID = cfg.AgentUuid
+		if err := a.writeConfig(); err != nil {
+			return err
+		}
+		report.Adopted = append(report.Adopted, fmt.Sprintf("%s: OS %s (existing Consul registration)", name, host))
+	} else {
+		if err := a.AddOS(addr, true, "", ""); err != nil {
+			return fmt.Errorf("adding OS: %s", err)
+		}
+		report.Adopted = append(report.Adopted, fmt.Sprintf("%s: OS %s", name, host))
+	}
+
+	for _, mc := range mysqlConfigs {
+		exists, err := a.serviceExists(mc.Name, "mysql-hr")
+		if err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("%s: MySQL %s: %s", name, mc.Name, err))
+			continue
+		}
+		if exists {
+			report.Adopted = append(report.Adopted, fmt.Sprintf("%s: MySQL %s (existing Consul registration)", name, mc.Name))
+			continue
+		}
+
+		source := "auto"
+		if qc, ok := qanConfigs[mc.Name]; ok && qc.CollectFrom != "" {
+			source = qc.CollectFrom
+		}
+		if err := a.AddMySQL(mc.Name, mc.DSN, source, true, nil); err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("%s: MySQL %s: %s", name, mc.Name, err))
+			continue
+		}
+		report.Adopted = append(report.Adopted, fmt.Sprintf("%s: MySQL %s", name, mc.Name))
+	}
+
+	return nil
+}
+
+// stopLegacyService stops a legacy agent daemon before migrating it,
+// trying systemd first since every OS pmm-client supports has it, then
+// falling back to the SysV "service" wrapper and the raw init.d script
+// for older installs that predate systemd.
+func stopLegacyService(names []string) error {
+	for _, name := range names {
+		if err := exec.Command("systemctl", "stop", name).Run(); err == nil {
+			return nil
+		}
+		if err := exec.Command("service", name, "stop").Run(); err == nil {
+			return nil
+		}
+		initScript := "/etc/init.d/" + name
+		if FileExists(initScript) {
+			if err := exec.Command(initScript, "stop").Run(); err == nil {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("could not stop via systemctl, service, or init.d (tried %v)", names)
+}
+
+// backupLegacyConfig moves configDir aside to "<configDir>.bak" (adding a
+// timestamp if a previous .bak already exists) so a failed or partial
+// migration never loses the original config.
+func backupLegacyConfig(configDir string) error {
+	if !FileExists(configDir) {
+		return nil
+	}
+	dest := configDir + ".bak"
+	if FileExists(dest) {
+		dest = fmt.Sprintf("%s.%d.bak", configDir, time.Now().Unix())
+	}
+	return os.Rename(configDir, dest)
+}
+
+// readLegacyMySQLConfigs reads every config/mysql-*.conf under configDir.
+func readLegacyMySQLConfigs(configDir string) ([]legacyMySQLConfig, error) {
+	matches, err := filepath.Glob(filepath.Join(configDir, "config", "mysql-*.conf"))
+	if err != nil {
+		return nil, err
+	}
+	var configs []legacyMySQLConfig
+	for _, path := range matches {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var c legacyMySQLConfig
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("parsing %s: %s", path, err)
+		}
+		configs = append(configs, c)
+	}
+	return configs, nil
+}
+
+// readLegacyQANConfig reads configDir's config/qan-<instanceName>.conf,
+// returning ok=false if it doesn't exist or doesn't parse (QAN config is
+// optional; AddMySQL's "auto" source is a reasonable fallback).
+func readLegacyQANConfig(configDir, instanceName string) (legacyQANConfig, bool) {
+	data, err := ioutil.ReadFile(filepath.Join(configDir, "config", "qan-"+instanceName+".conf"))
+	if err != nil {
+		return legacyQANConfig{}, false
+	}
+	var c legacyQANConfig
+	if err := json.Unmarshal(data, &c); err != nil {
+		return legacyQANConfig{}, false
+	}
+	return c, true
+}
+
+// --------------------------------------------------------------------------
+// Bulk fleet operations
+
+// DefaultServicesConcurrency is how many nodes ListServices queries at
+// once when no explicit concurrency is given.
+const DefaultServicesConcurrency = 8
+
+// ListNodes returns every Consul node name, via GET /v1/catalog/nodes,
+// optionally restricted to those matching nodeGlob (path.Match syntax;
+// "" matches every node). Used by 'pmm-admin services ls' and the other
+// 'services' subcommands to resolve which nodes a glob refers to.
+func (a *Admin) ListNodes(nodeGlob string) ([]string, error) {
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "nodes")
+	resp, content, err := a.consulAPI().Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, a.api.Error("GET", url, resp.StatusCode, http.StatusOK, content)
+	}
+
+	var entries []struct {
+		Node string
+	}
+	if string(content) != "null" {
+		if err := json.Unmarshal(content, &entries); err != nil {
+			return nil, err
+		}
+	}
+
+	var nodes []string
+	for _, e := range entries {
+		if nodeGlob != "" {
+			matched, err := path.Match(nodeGlob, e.Node)
+			if err != nil {
+				return nil, err
+			}
+			if !matched {
+				continue
+			}
+		}
+		nodes = append(nodes, e.Node)
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+// consulCatalogNodeService is the subset of one Consul GET
+// /v1/catalog/node/<node> response's "Services" entry that
+// NodeServices/CopyServices need to replay a registration elsewhere.
+// Notably absent is the check definition: Consul's catalog API only
+// ever returns a service's live check status (via /v1/health/node), not
+// the HTTP/Interval/Timeout it was registered with, so a copy can't
+// literally clone the original check - it gets a fresh one the same way
+// RegisterService builds one for a brand new registration.
+type consulCatalogNodeService struct {
+	Service string
+	Tags    []string
+	Port    uint16
+}
+
+// consulCatalogNode is a Consul GET /v1/catalog/node/<node> response,
+// trimmed to what NodeServices/NodeAddress need.
+type consulCatalogNode struct {
+	Node struct {
+		Node    string
+		Address string
+	}
+	Services map[string]consulCatalogNodeService
+}
+
+// nodeCatalog fetches node's full catalog entry, the basis for both
+// NodeServices and NodeAddress.
+func (a *Admin) nodeCatalog(node string) (consulCatalogNode, error) {
+	url := a.consulAPI().URL(a.ctx().ServerAddress+":"+CONSUL_PORT, "v1", "catalog", "node", node)
+	resp, content, err := a.consulAPI().Get(url)
+	if err != nil {
+		return consulCatalogNode{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return consulCatalogNode{}, a.api.Error("GET", url, resp.StatusCode, http.StatusOK, content)
+	}
+	if string(content) == "null" {
+		return consulCatalogNode{}, ErrNotFound
+	}
+
+	var data consulCatalogNode
+	if err := json.Unmarshal(content, &data); err != nil {
+		return consulCatalogNode{}, err
+	}
+	return data, nil
+}
+
+// NodeServices returns every service registered on node, keyed by job
+// name, for 'pmm-admin services ls/cp/rm'.
+func (a *Admin) NodeServices(node string) (map[string]ConsulService, error) {
+	data, err := a.nodeCatalog(node)
+	if err != nil {
+		return nil, err
+	}
+	services := map[string]ConsulService{}
+	for _, svc := range data.Services {
+		services[svc.Service] = ConsulService{Service: svc.Service, Port: svc.Port, Tags: svc.Tags}
+	}
+	return services, nil
+}
+
+// NodeAddress returns node's registered address, for 'services cp' to
+// target the destination node's own /metrics endpoint.
+func (a *Admin) NodeAddress(node string) (string, error) {
+	data, err := a.nodeCatalog(node)
+	if err != nil {
+		return "", err
+	}
+	if data.Node.Address == "" {
+		return "", fmt.Errorf("node %s has no registered address", node)
+	}
+	return data.Node.Address, nil
+}
+
+// ListServices returns every node matching nodeGlob (see ListNodes) and
+// the jobs registered on each, for 'pmm-admin services ls'. Nodes are
+// queried concurrently, up to concurrency at a time (concurrency <= 0
+// uses DefaultServicesConcurrency), since a large fleet otherwise makes
+// this one catalog/node request per node, in series, far slower than it
+// needs to be.
+func (a *Admin) ListServices(nodeGlob string, concurrency int) (map[string]map[string]ConsulService, error) {
+	nodes, err := a.ListNodes(nodeGlob)
+	if err != nil {
+		return nil, err
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultServicesConcurrency
+	}
+
+	type result struct {
+		node     string
+		services map[string]ConsulService
+		err      error
+	}
+	nodeCh := make(chan string)
+	resultCh := make(chan result)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for node := range nodeCh {
+				services, err := a.NodeServices(node)
+				resultCh <- result{node: node, services: services, err: err}
+			}
+		}()
+	}
+	go func() {
+		for _, node := range nodes {
+			nodeCh <- node
+		}
+		close(nodeCh)
+	}()
+	go func() {
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	matrix := map[string]map[string]ConsulService{}
+	var firstErr error
+	for r := range resultCh {
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %s", r.node, r.err)
+			}
+			continue
+		}
+		matrix[r.node] = r.services
+	}
+	if firstErr != nil {
+		return matrix, firstErr
+	}
+	return matrix, nil
+}
+
+// filterJobs returns jobs from services, restricted to only (if
+// non-empty), sorted for stable output.
+func filterJobs(services map[string]ConsulService, only []string) []string {
+	wanted := map[string]bool{}
+	for _, job := range only {
+		wanted[job] = true
+	}
+	var jobs []string
+	for job := range services {
+		if len(wanted) > 0 && !wanted[job] {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Strings(jobs)
+	return jobs
+}
+
+// CopyServices re-registers srcNode's services (or only those in jobs,
+// if non-empty) on dstNode, against dstNode's own registered address,
+// for 'pmm-admin services cp'. It returns the jobs copied (or, with
+// dryRun, the jobs that would be) without otherwise changing anything.
+func (a *Admin) CopyServices(srcNode, dstNode string, jobs []string, dryRun bool) ([]string, error) {
+	services, err := a.NodeServices(srcNode)
+	if err != nil {
+		return nil, err
+	}
+	toCopy := filterJobs(services, jobs)
+	if dryRun || len(toCopy) == 0 {
+		return toCopy, nil
+	}
+
+	dstAddress, err := a.NodeAddress(dstNode)
+	if err != nil {
+		return nil, err
+	}
+	target := Target{Node: dstNode, Address: dstAddress}
+
+	var copied []string
+	for _, job := range toCopy {
+		svc := services[job]
+		if err := a.RegisterService(target, job, svc.Port, svc.Tags); err != nil {
+			return copied, fmt.Errorf("copying %s to %s: %s", job, dstNode, err)
+		}
+		copied = append(copied, job)
+	}
+	return copied, nil
+}
+
+// RemoveServices deregisters node's services (or only those in jobs, if
+// non-empty), for 'pmm-admin services rm'. It returns the jobs removed
+// (or, with dryRun, the jobs that would be) without otherwise changing
+// anything.
+func (a *Admin) RemoveServices(node string, jobs []string, dryRun bool) ([]string, error) {
+	services, err := a.NodeServices(node)
+	if err != nil {
+		return nil, err
+	}
+	toRemove := filterJobs(services, jobs)
+	if dryRun || len(toRemove) == 0 {
+		return toRemove, nil
+	}
+
+	var removed []string
+	for _, job := range toRemove {
+		if err := a.DeregisterService(Target{Node: node}, job); err != nil {
+			return removed, fmt.Errorf("removing %s from %s: %s", job, node, err)
+		}
+		removed = append(removed, job)
+	}
+	return removed, nil
+}
+
+// --------------------------------------------------------------------------
+// Backup/restore of this host's Consul state
+
+// exportManifestVersion is bumped whenever ExportManifest's shape
+// changes incompatibly, so Import can refuse a manifest it doesn't
+// understand instead of silently misinterpreting it.
+const exportManifestVersion = 1
+
+// ExportManifest is the versioned snapshot Export/Import exchange:
+// every service this host has registered in Consul (the same
+// /v1/catalog/node/<node> data serviceExists checks), plus its backup
+// schedules, whose only other Consul footprint is the KV mirror under
+// pmm/backups/<uuid> (see mirrorBackupKV). Together that's everything
+// pmm-admin itself writes to Consul for this host, so it can be
+// replayed against a PMM server that lost its Consul state.
+type ExportManifest struct {
+	Version  int               `json:"version"`
+	Node     string            `json:"node"`
+	Address  string            `json:"address"`
+	Services []ExportedService `json:"services"`
+	Backups  []BackupJob       `json:"backups,omitempty"`
+}
+
+// ExportedService is one registered job in an ExportManifest.
+type ExportedService struct {
+	Job  string   `json:"job"`
+	Port uint16   `json:"port"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Export snapshots this host's Consul registrations and backup
+// schedules into a versioned JSON manifest written to w, for
+// 'pmm-admin backup export'.
+func (a *Admin) Export(w io.Writer) error {
+	os, err := a.OS()
+	if err != nil {
+		return err
+	}
+
+	data, err := a.nodeCatalog(os.Name)
+	if err != nil {
+		return err
+	}
+
+	manifest := ExportManifest{
+		Version: exportManifestVersion,
+		Node:    data.Node.Node,
+		Address: data.Node.Address,
+	}
+	for _, svc := range data.Services {
+		manifest.Services = append(manifest.Services, ExportedService{Job: svc.Service, Port: svc.Port, Tags: svc.Tags})
+	}
+	sort.Slice(manifest.Services, func(i, j int) bool { return manifest.Services[i].Job < manifest.Services[j].Job })
+
+	backups, err := a.ListBackups("")
+	if err != nil {
+		return err
+	}
+	manifest.Backups = backups
+
+	return json.NewEncoder(w).Encode(manifest)
+}
+
+// ImportReport summarizes what Import did with each manifest entry:
+// Restored means it was registered/added because it was missing or had
+// drifted from the manifest, Unchanged means it already matched, Failed
+// carries the error inline like MigrationReport does.
+type ImportReport struct {
+	Restored  []string
+	Unchanged []string
+	Failed    []string
+}
+
+// Import restores an ExportManifest read from r: for each service, it
+// registers only what's missing or drifted (tags/port differ from
+// what's already registered there), and for each backup schedule, it
+// adds only those not already present by name - so running Import
+// against a server whose state was never actually lost is a no-op.
+// Intended for 'pmm-admin restore' after a PMM server's Consul state
+// was lost.
+func (a *Admin) Import(r io.Reader) (ImportReport, error) {
+	var manifest ExportManifest
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return ImportReport{}, err
+	}
+	if manifest.Version != exportManifestVersion {
+		return ImportReport{}, fmt.Errorf("unsupported manifest version %d (expected %d)", manifest.Version, exportManifestVersion)
+	}
+	if manifest.Node == "" {
+		return ImportReport{}, fmt.Errorf("manifest has no node")
+	}
+
+	var report ImportReport
+	target := Target{Node: manifest.Node, Address: manifest.Address}
+
+	current, err := a.NodeServices(manifest.Node)
+	if err != nil {
+		if err != ErrNotFound {
+			return report, err
+		}
+		current = map[string]ConsulService{}
+	}
+
+	for _, svc := range manifest.Services {
+		if existing, ok := current[svc.Job]; ok && existing.Port == svc.Port && sameTags(existing.Tags, svc.Tags) {
+			report.Unchanged = append(report.Unchanged, svc.Job)
+			continue
+		}
+		if err := a.RegisterService(target, svc.Job, svc.Port, svc.Tags); err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("%s: %s", svc.Job, err))
+			continue
+		}
+		report.Restored = append(report.Restored, svc.Job)
+	}
+
+	existingBackups, err := a.ListBackups("")
+	if err != nil {
+		return report, err
+	}
+	knownBackups := map[string]bool{}
+	for _, b := range existingBackups {
+		knownBackups[b.Name] = true
+	}
+	for _, b := range manifest.Backups {
+		if knownBackups[b.Name] {
+			report.Unchanged = append(report.Unchanged, "backup:"+b.Name)
+			continue
+		}
+		if err := a.AddBackupSchedule(b.Name, b.Schedule, b.Destination, b.Retention); err != nil {
+			report.Failed = append(report.Failed, fmt.Sprintf("backup:%s: %s", b.Name, err))
+			continue
+		}
+		report.Restored = append(report.Restored, "backup:"+b.Name)
+	}
+
+	return report, nil
+}
+
+// sameTags reports whether a and b contain the same tags, ignoring
+// order.
+func sameTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string(nil), a...)
+	sortedB := append([]string(nil), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
 }
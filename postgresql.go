@@ -0,0 +1,144 @@
+/*
+   Copyright (c) 2016, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package pmm
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/lib/pq"
+)
+
+const (
+	DEFAULT_POSTGRESQL_USER = "pmm"
+	DEFAULT_POSTGRESQL_PASS = "percona2016"
+)
+
+// PostgreSQLDSN holds the connection parameters for a PostgreSQL instance,
+// analogous to dsn.DSN for MySQL.
+type PostgreSQLDSN struct {
+	Username string
+	Password string
+	Hostname string
+	Port     string
+	SSLMode  string
+}
+
+// String returns a libpq-style connection string.
+func (d PostgreSQLDSN) String() string {
+	sslmode := d.SSLMode
+	if sslmode == "" {
+		sslmode = "disable"
+	}
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s sslmode=%s dbname=postgres",
+		d.Hostname, d.Port, d.Username, d.Password, sslmode)
+}
+
+type PostgreSQLConn struct {
+	userDSN   PostgreSQLDSN
+	agentUser string
+	agentPass string
+}
+
+func NewPostgreSQLConn(userDSN PostgreSQLDSN, agentUser, agentPass string) *PostgreSQLConn {
+	return &PostgreSQLConn{
+		userDSN:   userDSN,
+		agentUser: agentUser,
+		agentPass: agentPass,
+	}
+}
+
+// MakePostgreSQLGrant returns the statements that create the agent role
+// with the read-only privileges mysqld_exporter's pg_monitor analog needs.
+func MakePostgreSQLGrant(dsn PostgreSQLDSN) []string {
+	return []string{
+		fmt.Sprintf("CREATE ROLE %s WITH LOGIN PASSWORD '%s'", dsn.Username, dsn.Password),
+		fmt.Sprintf("GRANT pg_monitor TO %s", dsn.Username),
+	}
+}
+
+func (p *PostgreSQLConn) AgentDSN() (agentDSN PostgreSQLDSN, err error) {
+	if p.agentUser != "" {
+		agentDSN = p.userDSN
+		agentDSN.Username = p.agentUser
+		agentDSN.Password = p.agentPass
+		err = p.TestConnection(agentDSN)
+	} else {
+		agentDSN, err = p.createAgentPostgreSQLUser(p.userDSN)
+	}
+	return
+}
+
+func (p *PostgreSQLConn) createAgentPostgreSQLUser(userDSN PostgreSQLDSN) (PostgreSQLDSN, error) {
+	db, err := sql.Open("postgres", userDSN.String())
+	if err != nil {
+		return PostgreSQLDSN{}, err
+	}
+	defer db.Close()
+
+	agentDSN := userDSN
+	agentDSN.Username = DEFAULT_POSTGRESQL_USER
+	agentDSN.Password = DEFAULT_POSTGRESQL_PASS
+
+	for _, grant := range MakePostgreSQLGrant(agentDSN) {
+		if _, err := db.Exec(grant); err != nil {
+			return PostgreSQLDSN{}, fmt.Errorf("cannot execute %s: %s", grant, err)
+		}
+	}
+
+	if err := p.TestConnection(agentDSN); err != nil {
+		return PostgreSQLDSN{}, err
+	}
+
+	return agentDSN, nil
+}
+
+func (p *PostgreSQLConn) TestConnection(newDSN PostgreSQLDSN) error {
+	db, err := sql.Open("postgres", newDSN.String())
+	if err != nil {
+		return fmt.Errorf("cannot connect to PostgreSQL %s:%s: %s", newDSN.Hostname, newDSN.Port, err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		return fmt.Errorf("cannot connect to PostgreSQL %s:%s: %s", newDSN.Hostname, newDSN.Port, err)
+	}
+
+	return nil
+}
+
+func (p *PostgreSQLConn) Info(infoDSN PostgreSQLDSN) (map[string]string, error) {
+	db, err := sql.Open("postgres", infoDSN.String())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var hostname, version string
+	if err := db.QueryRow("SELECT inet_server_addr()::text, version()").Scan(&hostname, &version); err != nil {
+		return nil, err
+	}
+
+	info := map[string]string{
+		"hostname": hostname,
+		"port":     infoDSN.Port,
+		"distro":   "PostgreSQL",
+		"version":  version,
+	}
+	return info, nil
+}
@@ -0,0 +1,89 @@
+/*
+   Copyright (c) 2016, Percona LLC and/or its affiliates. All rights reserved.
+
+   This program is free software: you can redistribute it and/or modify
+   it under the terms of the GNU Affero General Public License as published by
+   the Free Software Foundation, either version 3 of the License, or
+   (at your option) any later version.
+
+   This program is distributed in the hope that it will be useful,
+   but WITHOUT ANY WARRANTY; without even the implied warranty of
+   MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+   GNU Affero General Public License for more details.
+
+   You should have received a copy of the GNU Affero General Public License
+   along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package pmm
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+const (
+	DEFAULT_PROXYSQL_ADMIN_PORT = "6032"
+)
+
+// ProxySQLDSN addresses ProxySQL's admin interface, which speaks the MySQL
+// protocol on a separate port (6032 by default) from the traffic port.
+type ProxySQLDSN struct {
+	Username string
+	Password string
+	Hostname string
+	Port     string
+}
+
+func (d ProxySQLDSN) String() string {
+	port := d.Port
+	if port == "" {
+		port = DEFAULT_PROXYSQL_ADMIN_PORT
+	}
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/", d.Username, d.Password, d.Hostname, port)
+}
+
+type ProxySQLConn struct {
+	adminDSN ProxySQLDSN
+}
+
+func NewProxySQLConn(adminDSN ProxySQLDSN) *ProxySQLConn {
+	return &ProxySQLConn{adminDSN: adminDSN}
+}
+
+func (p *ProxySQLConn) TestConnection() error {
+	db, err := sql.Open("mysql", p.adminDSN.String())
+	if err != nil {
+		return fmt.Errorf("cannot connect to ProxySQL admin interface %s:%s: %s", p.adminDSN.Hostname, p.adminDSN.Port, err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		return fmt.Errorf("cannot connect to ProxySQL admin interface %s:%s: %s", p.adminDSN.Hostname, p.adminDSN.Port, err)
+	}
+
+	return nil
+}
+
+func (p *ProxySQLConn) Info() (map[string]string, error) {
+	db, err := sql.Open("mysql", p.adminDSN.String())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var version string
+	if err := db.QueryRow("SELECT VERSION()").Scan(&version); err != nil {
+		return nil, err
+	}
+
+	info := map[string]string{
+		"hostname": p.adminDSN.Hostname,
+		"port":     p.adminDSN.Port,
+		"distro":   "ProxySQL",
+		"version":  version,
+	}
+	return info, nil
+}
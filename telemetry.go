@@ -0,0 +1,145 @@
+/*
+	Copyright (c) 2016, Percona LLC and/or its affiliates. All rights reserved.
+
+	This program is free software: you can redistribute it and/or modify
+	it under the terms of the GNU Affero General Public License as published by
+	the Free Software Foundation, either version 3 of the License, or
+	(at your option) any later version.
+
+	This program is distributed in the hope that it will be useful,
+	but WITHOUT ANY WARRANTY; without even the implied warranty of
+	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+	GNU Affero General Public License for more details.
+
+	You should have received a copy of the GNU Affero General Public License
+	along with this program.  If not, see <http://www.gnu.org/licenses/>
+*/
+
+package pmm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// tracer is used by API.do to span every HTTP request this process
+// makes (Consul catalog/health/KV, QAN, Prometheus/agent). It works
+// even before InitTelemetry is called: with no TracerProvider
+// configured, otel's default is a no-op, so spans cost nothing until
+// tracing is actually turned on.
+var tracer = otel.Tracer("github.com/percona/pmm-admin")
+
+// TelemetryOptions configures OpenTelemetry tracing for every request
+// the Admin API client makes, set via 'pmm-admin server -otlp-endpoint
+// -otlp-sample-rate' the same way Consul auth is (see
+// Admin.SetTelemetryConfig/TelemetryOptions).
+type TelemetryOptions struct {
+	// OTLPEndpoint is a host:port gRPC OTLP collector address. Empty
+	// (the default) leaves tracing off: spans are still created, but
+	// never exported anywhere.
+	OTLPEndpoint string
+
+	// SampleRate is the fraction of requests traced, in (0, 1]. Treated
+	// as 1 (trace everything) if zero, since a collector only set up for
+	// testing normally wants every request.
+	SampleRate float64
+}
+
+// InitTelemetry configures the global OTel TracerProvider from opts,
+// called once at 'pmm-admin' startup. It uses a synchronous span
+// processor rather than the usual batching one: pmm-admin is almost
+// always a one-shot command that exits right after its single
+// operation, so a batch waiting to flush would just be lost when the
+// process exits, the same way os.Exit skips deferred funcs. The
+// returned shutdown func closes the exporter connection; it's only
+// worth calling from a long-running command (k8s-controller,
+// metrics-server), not a one-shot one, since every span is already
+// exported by the time it returns. Returns a nil shutdown and nil error
+// if opts.OTLPEndpoint is empty.
+func InitTelemetry(opts TelemetryOptions) (func(context.Context) error, error) {
+	if opts.OTLPEndpoint == "" {
+		return nil, nil
+	}
+
+	exporter, err := otlptracegrpc.New(context.Background(),
+		otlptracegrpc.WithEndpoint(opts.OTLPEndpoint),
+		otlptracegrpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to OTLP endpoint %s: %s", opts.OTLPEndpoint, err)
+	}
+
+	rate := opts.SampleRate
+	if rate <= 0 {
+		rate = 1
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter)),
+		sdktrace.WithSampler(sdktrace.TraceIDRatioBased(rate)),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// requestAttrs are the extra span attributes a caller can attach to a
+// request via WithRequestAttrs, for requests (like serviceExists/
+// RegisterService) that know which Consul node/job they're about.
+type requestAttrs struct {
+	node string
+	job  string
+}
+
+type requestAttrsKey struct{}
+
+// WithRequestAttrs attaches node/job to ctx, read back by API.do (via
+// GetCtx/PutCtx) as the pmm.node/pmm.job span attributes, so call sites
+// that know which node/job a request is about don't have to thread them
+// through API's method signatures directly.
+func WithRequestAttrs(ctx context.Context, node, job string) context.Context {
+	return context.WithValue(ctx, requestAttrsKey{}, requestAttrs{node: node, job: job})
+}
+
+func requestAttrsFrom(ctx context.Context) (requestAttrs, bool) {
+	attrs, ok := ctx.Value(requestAttrsKey{}).(requestAttrs)
+	return attrs, ok
+}
+
+// Self-metrics for every request API.do makes, labeled by backend (see
+// APIOptions.Backend) so "Consul is slow" and "QAN is slow" show up as
+// separate series instead of one undifferentiated blob.
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pmm_admin_api_requests_total",
+		Help: "Total API requests made by pmm-admin, by backend, method, and status.",
+	}, []string{"backend", "method", "status"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "pmm_admin_api_request_duration_seconds",
+		Help: "API request latency in seconds, by backend and method.",
+	}, []string{"backend", "method"})
+
+	retriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pmm_admin_api_retries_total",
+		Help: "Retried API requests, by backend and method.",
+	}, []string{"backend", "method"})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, requestDuration, retriesTotal)
+}
+
+// MetricsHandler serves the pmm_admin_api_* collectors above (plus the
+// promhttp/process/Go defaults), for 'pmm-admin metrics-server' - a
+// long-running daemon mode an operator points Prometheus at directly,
+// for the requests, latencies, and retries an OTLP collector wouldn't
+// be set up to capture on its own.
+func MetricsHandler() http.Handler {
+	return promhttp.Handler()
+}